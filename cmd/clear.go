@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/reubenmiller/c8y-session-bitwarden/pkg/core/state"
+	"github.com/spf13/cobra"
+)
+
+// clearCmd represents the clear command
+var clearCmd = &cobra.Command{
+	Use:   "clear [SESSION_URI...]",
+	Short: "Clear the local state kept by this tool",
+	Long: heredoc.Doc(`
+		Clear the local state (e.g. history and caches) kept by this tool. No secrets are stored in the local state.
+
+		If no sessions are given, then the state of all sessions is removed. The hidden and pinned sessions
+		are kept, use the 'prefs reset' command to remove them.
+
+		Examples
+			c8y-session-bitwarden clear
+			# Clear the local state of all sessions
+
+			c8y-session-bitwarden clear bitwarden://2b4e1c2a-58a6-4fb2-8b3c-b1a400a6f2e1
+			# Clear the local state of a single session
+	`),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return state.Clear(args...)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(clearCmd)
+}
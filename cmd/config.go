@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/reubenmiller/c8y-session-bitwarden/pkg/core/config"
+	"github.com/reubenmiller/c8y-session-bitwarden/pkg/core/picker"
+	"github.com/spf13/cobra"
+)
+
+// addThemeFlag adds the flag used to select the theme of the picker
+func addThemeFlag(cmd *cobra.Command) {
+	cmd.Flags().String("theme", "", fmt.Sprintf("Colour theme of the picker (overrides the config file). Accepted values: %s", strings.Join(picker.Themes, ", ")))
+	cmd.RegisterFlagCompletionFunc("theme", cobra.FixedCompletions(picker.Themes, cobra.ShellCompDirectiveNoFileComp))
+}
+
+// getTheme returns the theme of the picker using the theme flag and the config file
+func getTheme(cmd *cobra.Command, cfg *config.Config) (*picker.Theme, error) {
+	name, err := cmd.Flags().GetString("theme")
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = cfg.Theme
+	}
+	return picker.NewTheme(name, cfg.Colors)
+}
+
+// addKeyMapFlag adds the flag used to select the key bindings of the picker
+func addKeyMapFlag(cmd *cobra.Command) {
+	cmd.Flags().String("keymap", "", fmt.Sprintf("Key bindings of the picker (overrides the config file). Accepted values: %s", strings.Join(picker.KeyMaps, ", ")))
+	cmd.RegisterFlagCompletionFunc("keymap", cobra.FixedCompletions(picker.KeyMaps, cobra.ShellCompDirectiveNoFileComp))
+}
+
+// getKeyBindings returns the key bindings of the picker using the keymap flag and the config file
+func getKeyBindings(cmd *cobra.Command, cfg *config.Config) (picker.KeyBindings, error) {
+	name, err := cmd.Flags().GetString("keymap")
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = cfg.KeyMap
+	}
+	return picker.NewKeyBindings(name, cfg.Keys)
+}
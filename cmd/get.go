@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/reubenmiller/c8y-session-bitwarden/pkg/bitwarden"
+	"github.com/spf13/cobra"
+)
+
+// getCmd represents the get command
+var getCmd = &cobra.Command{
+	Use:   "get <bitwarden://id | id | id-prefix>",
+	Short: "Get a session by its SessionURI or bitwarden item id",
+	Long: heredoc.Doc(`
+		Get a single Cumulocity IoT session from your bitwarden vault without the interactive picker.
+
+		The session can be referenced by the SessionURI returned by the list command (bitwarden://<id>),
+		the bitwarden item id, or a unique prefix of the item id. The current password and TOTP code are
+		included in the output, which allows sessions to be re-used in scripts.
+
+		Examples
+			c8y-session-bitwarden get bitwarden://2b4e1c2a-58a6-4fb2-8b3c-b1a400a6f2e1
+			# Get a session by its SessionURI
+
+			c8y-session-bitwarden get 2b4e1c2a --output bash
+			# Get a session by an id prefix and print it as bash exports
+	`),
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		writer, err := newSessionWriter(cmd)
+		if err != nil {
+			return err
+		}
+
+		client := bitwarden.NewClient("")
+		session, err := client.Get(args[0])
+		if err != nil {
+			return err
+		}
+		return writer.Write(withSecrets(session))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(getCmd)
+	addOutputFlags(getCmd)
+}
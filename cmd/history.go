@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/reubenmiller/c8y-session-bitwarden/pkg/bitwarden"
+	"github.com/reubenmiller/c8y-session-bitwarden/pkg/core"
+	"github.com/reubenmiller/c8y-session-bitwarden/pkg/core/state"
+	"github.com/spf13/cobra"
+)
+
+// addSortFlag adds the flag used to control the order of the sessions
+func addSortFlag(cmd *cobra.Command) {
+	cmd.Flags().String("sort", state.SortVault, fmt.Sprintf("Order of the sessions (vault order is sorted by relevance when searching). Accepted values: %s", strings.Join(state.SortOptions, ", ")))
+	cmd.RegisterFlagCompletionFunc("sort", cobra.FixedCompletions(state.SortOptions, cobra.ShellCompDirectiveNoFileComp))
+}
+
+// sortSessions orders the sessions using the selection history. If no search terms were used,
+// then history entries of sessions which no longer exist are removed
+func sortSessions(cmd *cobra.Command, sessions []*core.CumulocitySession, searchTerms []string) error {
+	order, err := cmd.Flags().GetString("sort")
+	if err != nil {
+		return err
+	}
+
+	history, err := state.LoadHistory()
+	if err != nil {
+		slog.Warn("Could not load the history.", "err", err)
+		return nil
+	}
+
+	if len(searchTerms) == 0 && history.Prune(sessions) {
+		if err := history.Save(); err != nil {
+			slog.Warn("Could not save the history.", "err", err)
+		}
+	}
+	return history.Sort(sessions, order)
+}
+
+// getLastSession returns the most recently selected session. The history entry is removed
+// if the session no longer exists
+func getLastSession(client *bitwarden.Client) (*core.CumulocitySession, error) {
+	history, err := state.LoadHistory()
+	if err != nil {
+		return nil, err
+	}
+	uri, ok := history.Last()
+	if !ok {
+		return nil, fmt.Errorf("no previously selected session found in the history")
+	}
+	session, err := client.Get(uri)
+	if err != nil {
+		if errors.Is(err, bitwarden.ErrNotFound) && history.Remove(uri) {
+			if saveErr := history.Save(); saveErr != nil {
+				slog.Warn("Could not save the history.", "err", saveErr)
+			}
+		}
+		return nil, fmt.Errorf("could not get the previously selected session. %w", err)
+	}
+	return session, nil
+}
+
+// recordSelection adds the selected session to the history
+func recordSelection(s *core.CumulocitySession) {
+	history, err := state.LoadHistory()
+	if err == nil {
+		history.Record(s)
+		err = history.Save()
+	}
+	if err != nil {
+		slog.Warn("Could not record the selected session in the history.", "err", err)
+	}
+}
@@ -4,12 +4,17 @@ Copyright © 2024 Reuben Miller
 package cmd
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
+	"log/slog"
+	"strings"
 
 	"github.com/MakeNowJust/heredoc/v2"
 	"github.com/reubenmiller/c8y-session-bitwarden/pkg/bitwarden"
+	"github.com/reubenmiller/c8y-session-bitwarden/pkg/core"
+	"github.com/reubenmiller/c8y-session-bitwarden/pkg/core/config"
 	"github.com/reubenmiller/c8y-session-bitwarden/pkg/core/picker"
+	"github.com/reubenmiller/c8y-session-bitwarden/pkg/core/state"
 	"github.com/spf13/cobra"
 )
 
@@ -36,6 +41,24 @@ var listCmd = &cobra.Command{
 
 			c8y-session-bitwarden list --folder c8y example.com dev
 			# Select items from the c8y folder, and match the search term, "example.com" AND "dev"
+
+			eval "$(c8y-session-bitwarden list --folder c8y --output bash)"
+			# Select a session and export it as C8Y_* environment variables in the current shell
+
+			c8y-session-bitwarden list --last
+			# Select the same session as last time (without showing the picker)
+
+			c8y-session-bitwarden list --folder "" --browse
+			# Choose a folder (or organization) first, and then a session from it
+
+			c8y-session-bitwarden list --multi --output json
+			# Select several sessions and print them as a json array
+
+			c8y-session-bitwarden list --accessible
+			# Select a session from a numbered list, e.g. when using a screen reader
+
+			c8y-session-bitwarden list --template 'user = "{{ .Username }}:{{ .Password }}"{{ "\n" }}'
+			# Select a session and write a curl config file
 	`),
 	SilenceUsage: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -43,49 +66,225 @@ var listCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		client := bitwarden.NewClient(folder)
-		sessions, err := client.List(args...)
+		writer, err := newSessionWriter(cmd)
 		if err != nil {
 			return err
 		}
-
-		session, err := picker.Pick(sessions, picker.PickerOptions{
-			AutoSelectIfOnlyOne: true,
-		})
+		loginType, err := getLoginType(cmd)
+		if err != nil {
+			return err
+		}
+		clearState, err := cmd.Flags().GetBool("clear")
+		if err != nil {
+			return err
+		}
+		showPreview, err := cmd.Flags().GetBool("preview")
+		if err != nil {
+			return err
+		}
+		groupBy, err := cmd.Flags().GetString("group-by")
+		if err != nil {
+			return err
+		}
+		if err := picker.ValidateGroupBy(groupBy); err != nil {
+			return err
+		}
+		layout, err := cmd.Flags().GetString("layout")
+		if err != nil {
+			return err
+		}
+		columns, err := cmd.Flags().GetStringSlice("columns")
+		if err != nil {
+			return err
+		}
+		if err := picker.ValidateLayout(layout, columns); err != nil {
+			return err
+		}
+		height, err := cmd.Flags().GetInt("height")
+		if err != nil {
+			return err
+		}
+		last, err := cmd.Flags().GetBool("last")
+		if err != nil {
+			return err
+		}
+		autoSelectBest, err := cmd.Flags().GetBool("auto-select-best")
+		if err != nil {
+			return err
+		}
+		backend, err := cmd.Flags().GetString("picker")
+		if err != nil {
+			return err
+		}
+		if err := picker.ValidateBackend(backend); err != nil {
+			return err
+		}
+		accessible, err := cmd.Flags().GetBool("accessible")
+		if err != nil {
+			return err
+		}
+		if accessible {
+			backend = picker.BackendPrompt
+		}
+		showHidden, err := cmd.Flags().GetBool("show-hidden")
+		if err != nil {
+			return err
+		}
+		multi, err := cmd.Flags().GetBool("multi")
+		if err != nil {
+			return err
+		}
+		browse, err := cmd.Flags().GetBool("browse")
+		if err != nil {
+			return err
+		}
+		cfg, err := config.Load()
+		if err != nil {
+			return err
+		}
+		theme, err := getTheme(cmd, cfg)
+		if err != nil {
+			return err
+		}
+		keyBindings, err := getKeyBindings(cmd, cfg)
+		if err != nil {
+			return err
+		}
+		query, err := parseSearchTerms(args)
 		if err != nil {
 			return err
 		}
 
-		// Check if TOTP secret is present and calc next code
-		for _, s := range sessions {
-			if session.SessionURI == s.SessionURI {
-				session.Password = s.Password
-				if s.TOTPSecret != "" {
-					totp, toptErr := bitwarden.GetTOTPCodeFromSecret(s.TOTPSecret)
-					if toptErr == nil {
-						session.TOTP = totp
+		client := bitwarden.NewClient(folder)
+		if client.Fuzzy, err = cmd.Flags().GetBool("fuzzy"); err != nil {
+			return err
+		}
+		query.Fuzzy = client.Fuzzy
+
+		var selected []*core.CumulocitySession
+
+		if last {
+			// Reselect the previous session without showing the picker
+			session, err := getLastSession(client)
+			if err != nil {
+				return err
+			}
+			selected = []*core.CumulocitySession{session}
+		} else {
+			prefs := loadPrefs()
+
+			// The sessions are loaded whilst the picker is already shown
+			loader := func(ctx context.Context, progress func(string), stream func([]*core.CumulocitySession)) ([]*core.CumulocitySession, error) {
+				sessions, err := client.ListWithProgress(progress, func(batch []*core.CumulocitySession) {
+					if stream != nil {
+						stream(applyPrefs(prefs, batch, showHidden))
 					}
-					break
+				}, args...)
+				if err != nil {
+					return nil, err
+				}
+				if err := sortSessions(cmd, sessions, args); err != nil {
+					return nil, err
+				}
+				return applyPrefs(prefs, sessions, showHidden), nil
+			}
+
+			// Pull the latest changes from the server first, e.g. when a tenant has just been shared
+			refresh := func(ctx context.Context, progress func(string), stream func([]*core.CumulocitySession)) ([]*core.CumulocitySession, error) {
+				progress("syncing vault")
+				if err := client.Sync(); err != nil {
+					return nil, err
 				}
+				return loader(ctx, progress, stream)
+			}
+
+			// Write changes of the edit form back to the vault. Conflicts are detected using the revision date
+			save := func(ctx context.Context, s *core.CumulocitySession, edit *core.SessionEdit) (*core.CumulocitySession, error) {
+				return client.Edit(s.SessionURI, s.RevisionDate, edit)
+			}
+
+			options := picker.PickerOptions{
+				Loader:              loader,
+				Refresh:             refresh,
+				Save:                save,
+				Backend:             backend,
+				AutoSelectIfOnlyOne: true,
+				AutoSelectBestMatch: autoSelectBest,
+				Query:               query,
+				ShowPreview:         showPreview,
+				GroupBy:             groupBy,
+				Layout:              layout,
+				Columns:             columns,
+				Height:              height,
+				Multi:               multi,
+				Browse:              browse,
+				Theme:               theme,
+				Keys:                keyBindings,
+			}
+			if prefs != nil {
+				options.Prefs = prefs
+			}
+
+			selected, err = picker.Pick(cmd.Context(), nil, options)
+			if err != nil {
+				return err
 			}
 		}
 
-		out, err := json.MarshalIndent(session, "", "  ")
-		if err != nil {
-			return err
+		for i, session := range selected {
+			// Use the original session to get the password and calc the next TOTP code
+			session = withSecrets(session)
+
+			if loginType != "" {
+				session.LoginType = loginType
+			}
+
+			// Clear the state before recording the selection, so that the new history entry is kept
+			if clearState {
+				if err := state.Clear(session.SessionURI); err != nil {
+					slog.Warn("Could not clear the local state of the session.", "session", session.SessionURI, "err", err)
+				}
+			}
+
+			recordSelection(session)
+			selected[i] = session
+		}
+
+		if multi {
+			return writer.WriteAll(selected)
 		}
-		fmt.Printf("%s\n", out)
-		return err
+		return writer.Write(selected[0])
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(listCmd)
 	listCmd.Flags().String("folder", "c8y", "Folder")
+	listCmd.Flags().String("picker", picker.BackendBuiltin, fmt.Sprintf("Picker used to select the session. Accepted values: %s", strings.Join(picker.Backends, ", ")))
+	listCmd.RegisterFlagCompletionFunc("picker", cobra.FixedCompletions(picker.Backends, cobra.ShellCompDirectiveNoFileComp))
+	listCmd.Flags().Bool("accessible", false, "Select the session using a numbered list and a line-based prompt (same as --picker prompt), e.g. for screen readers. Used automatically when the terminal does not support cursor addressing (e.g. TERM=dumb)")
+	listCmd.MarkFlagsMutuallyExclusive("picker", "accessible")
+	listCmd.Flags().Int("height", 0, fmt.Sprintf("Draw the picker inline (below the prompt) with the given number of rows instead of using the full screen. Used automatically when the terminal has less than %d rows", picker.InlineThreshold))
+	listCmd.Flags().Bool("preview", false, "Show the detail preview of the highlighted session (toggle with 'v')")
+	listCmd.Flags().String("group-by", "", fmt.Sprintf("Group the sessions in the picker. Accepted values: %s", strings.Join(picker.GroupByOptions, ", ")))
+	listCmd.RegisterFlagCompletionFunc("group-by", cobra.FixedCompletions(picker.GroupByOptions, cobra.ShellCompDirectiveNoFileComp))
+	listCmd.Flags().String("layout", picker.LayoutDefault, fmt.Sprintf("Picker layout. Accepted values: %s", strings.Join(picker.Layouts, ", ")))
+	listCmd.Flags().StringSlice("columns", nil, fmt.Sprintf("Columns shown in the table layout. Accepted values: %s", strings.Join(picker.TableColumns(), ", ")))
+	listCmd.RegisterFlagCompletionFunc("layout", cobra.FixedCompletions(picker.Layouts, cobra.ShellCompDirectiveNoFileComp))
+	listCmd.RegisterFlagCompletionFunc("columns", cobra.FixedCompletions(picker.TableColumns(), cobra.ShellCompDirectiveNoFileComp))
+	listCmd.Flags().Bool("last", false, "Select the previously selected session without showing the picker")
+	listCmd.Flags().Bool("fuzzy", false, "Allow typo-tolerant matches of the search terms")
+	listCmd.Flags().Bool("auto-select-best", false, "Select the session without showing the picker if it is clearly the best match, e.g. an exact host or tenant match")
+	addSortFlag(listCmd)
+	addShowHiddenFlag(listCmd)
+	listCmd.Flags().Bool("browse", false, "Choose a folder or organization first, and then one of its sessions (backspace returns to the folders)")
+	listCmd.Flags().Bool("multi", false, "Select several sessions (toggle with space). The json output is an array, other formats contain one block per session")
+	addThemeFlag(listCmd)
+	addKeyMapFlag(listCmd)
+	addOutputFlags(listCmd)
 
-	// Hidden flags which are only there to satisfy the go-c8y-cli session interface
-	listCmd.Flags().String("loginType", "", "Not used. Kept to satisfy the go-c8y-cli session interface")
-	listCmd.Flags().Bool("clear", false, "Not used. Kept to satisfy the go-c8y-cli session interface")
-	listCmd.Flags().MarkHidden("loginType")
-	listCmd.Flags().MarkHidden("clear")
+	// Flags which are part of the go-c8y-cli session interface
+	listCmd.Flags().String("loginType", "", fmt.Sprintf("Override the login type of the selected session. Accepted values: %s", strings.Join(core.LoginTypes, ", ")))
+	listCmd.Flags().Bool("clear", false, "Clear the local state (e.g. history and caches) of the selected session")
+	listCmd.RegisterFlagCompletionFunc("loginType", cobra.FixedCompletions(core.LoginTypes, cobra.ShellCompDirectiveNoFileComp))
 }
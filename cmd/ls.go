@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/reubenmiller/c8y-session-bitwarden/pkg/bitwarden"
+	"github.com/reubenmiller/c8y-session-bitwarden/pkg/core"
+	"github.com/reubenmiller/c8y-session-bitwarden/pkg/core/format"
+	"github.com/spf13/cobra"
+)
+
+// lsCmd represents the ls command
+var lsCmd = &cobra.Command{
+	Use:   "ls [SEARCH_TERMS]",
+	Short: "Print all matching sessions without selecting one",
+	Long: heredoc.Doc(`
+		Print all Cumulocity IoT sessions from your bitwarden vault which match the search terms.
+		No interactive picker is shown, which makes it suitable for scripts and CI logs.
+
+		Secrets (password and totp) are excluded unless --show-secrets is used.
+
+		Examples
+			c8y-session-bitwarden ls --folder c8y
+			# Print all sessions in the c8y folder as a table
+
+			c8y-session-bitwarden ls --folder c8y example.com --output csv
+			# Print the sessions matching "example.com" as csv
+
+			c8y-session-bitwarden ls --columns name,host,tenant --output jsonl
+			# Print only the name, host and tenant of each session as json lines
+
+			c8y-session-bitwarden ls -- -mode:prod host:eu-latest
+			# Print the sessions which are not in production mode (a leading negated term must be given after --)
+	`),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		folder, err := cmd.Flags().GetString("folder")
+		if err != nil {
+			return err
+		}
+		outputFormat, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return err
+		}
+		columnNames, err := cmd.Flags().GetStringSlice("columns")
+		if err != nil {
+			return err
+		}
+		showSecrets, err := cmd.Flags().GetBool("show-secrets")
+		if err != nil {
+			return err
+		}
+		showHidden, err := cmd.Flags().GetBool("show-hidden")
+		if err != nil {
+			return err
+		}
+		if showSecrets && len(columnNames) == 0 {
+			columnNames = append(append(columnNames, format.DefaultColumns...), "password", "totp")
+		}
+		columns, err := format.ResolveColumns(columnNames, showSecrets)
+		if err != nil {
+			return err
+		}
+
+		if _, err := parseSearchTerms(args); err != nil {
+			return err
+		}
+
+		client := bitwarden.NewClient(folder)
+		if client.Fuzzy, err = cmd.Flags().GetBool("fuzzy"); err != nil {
+			return err
+		}
+		sessions, err := client.List(args...)
+		if err != nil {
+			return err
+		}
+		if err := sortSessions(cmd, sessions, args); err != nil {
+			return err
+		}
+		sessions = applyPrefs(loadPrefs(), sessions, showHidden)
+
+		for _, s := range sessions {
+			if showSecrets {
+				if s.TOTPSecret != "" {
+					if totp, totpErr := core.GetTOTPCodeFromSecret(s.TOTPSecret); totpErr == nil {
+						s.TOTP = totp
+					}
+				}
+			} else {
+				s.Password = ""
+				s.TOTPSecret = ""
+			}
+		}
+
+		return format.WriteList(cmd.OutOrStdout(), outputFormat, sessions, columns)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(lsCmd)
+	lsCmd.Flags().String("folder", "c8y", "Folder")
+	lsCmd.Flags().StringP("output", "o", format.ListFormatTable, fmt.Sprintf("Output format. Accepted values: %s", strings.Join(format.ListFormats, ", ")))
+	lsCmd.Flags().StringSlice("columns", nil, fmt.Sprintf("Columns to include. Accepted values: %s", strings.Join(format.Columns(), ", ")))
+	lsCmd.Flags().Bool("fuzzy", false, "Allow typo-tolerant matches of the search terms")
+	addSortFlag(lsCmd)
+	addShowHiddenFlag(lsCmd)
+	lsCmd.Flags().Bool("show-secrets", false, "Include secrets (password and totp) in the output")
+
+	lsCmd.RegisterFlagCompletionFunc("output", cobra.FixedCompletions(format.ListFormats, cobra.ShellCompDirectiveNoFileComp))
+	lsCmd.RegisterFlagCompletionFunc("columns", cobra.FixedCompletions(format.Columns(), cobra.ShellCompDirectiveNoFileComp))
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/reubenmiller/c8y-session-bitwarden/pkg/core"
+	"github.com/reubenmiller/c8y-session-bitwarden/pkg/core/format"
+	"github.com/spf13/cobra"
+)
+
+// addOutputFlags adds the flags used to control how a selected session is written
+func addOutputFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("output", "o", format.FormatJSON, fmt.Sprintf("Output format. Accepted values: %s", strings.Join(format.Formats, ", ")))
+	cmd.Flags().String("template", "", "Go template used to format the session (overrides --output)")
+	cmd.Flags().String("template-file", "", "File containing a Go template used to format the session (overrides --output)")
+	cmd.MarkFlagsMutuallyExclusive("template", "template-file")
+
+	cmd.RegisterFlagCompletionFunc("output", cobra.FixedCompletions(format.Formats, cobra.ShellCompDirectiveNoFileComp))
+	cmd.MarkFlagFilename("template-file")
+}
+
+// sessionWriter writes sessions using the output flags of a command
+type sessionWriter struct {
+	cmd    *cobra.Command
+	format string
+	tmpl   *template.Template
+}
+
+func newSessionWriter(cmd *cobra.Command) (*sessionWriter, error) {
+	outputFormat, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return nil, err
+	}
+	w := &sessionWriter{
+		cmd:    cmd,
+		format: outputFormat,
+	}
+
+	if text, _ := cmd.Flags().GetString("template"); text != "" {
+		w.tmpl, err = format.ParseTemplate(text)
+	} else if path, _ := cmd.Flags().GetString("template-file"); path != "" {
+		w.tmpl, err = format.ParseTemplateFile(path)
+	}
+	return w, err
+}
+
+func (w *sessionWriter) Write(s *core.CumulocitySession) error {
+	if w.tmpl != nil {
+		return format.WriteTemplate(w.cmd.OutOrStdout(), w.tmpl, s)
+	}
+	return format.Write(w.cmd.OutOrStdout(), w.format, s)
+}
+
+// WriteAll writes several sessions, e.g. as a json array. Templates are executed once per session
+func (w *sessionWriter) WriteAll(sessions []*core.CumulocitySession) error {
+	if w.tmpl != nil {
+		for _, s := range sessions {
+			if err := format.WriteTemplate(w.cmd.OutOrStdout(), w.tmpl, s); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return format.WriteAll(w.cmd.OutOrStdout(), w.format, sessions)
+}
+
+// withSecrets returns a copy of the session which only contains the details to be passed back
+// to the caller along with the password and the current TOTP code (if a TOTP secret is present)
+func withSecrets(s *core.CumulocitySession) *core.CumulocitySession {
+	out := core.CloneSession(s)
+	out.Password = s.Password
+	if s.TOTPSecret != "" {
+		if totp, totpErr := core.GetTOTPCodeFromSecret(s.TOTPSecret); totpErr == nil {
+			out.TOTP = totp
+		}
+	}
+	return out
+}
+
+// getLoginType returns the normalized value of the --loginType flag (if set)
+func getLoginType(cmd *cobra.Command) (string, error) {
+	v, err := cmd.Flags().GetString("loginType")
+	if err != nil || v == "" {
+		return "", err
+	}
+	return core.MarshalLoginType(v)
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"text/tabwriter"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/reubenmiller/c8y-session-bitwarden/pkg/core"
+	"github.com/reubenmiller/c8y-session-bitwarden/pkg/core/state"
+	"github.com/spf13/cobra"
+)
+
+// prefsCmd represents the prefs command
+var prefsCmd = &cobra.Command{
+	Use:   "prefs",
+	Short: "List the hidden and pinned sessions",
+	Long: heredoc.Doc(`
+		List the sessions which were hidden or pinned in the picker (using the hide and pin actions).
+
+		Hidden sessions are not listed unless --show-hidden is used, and pinned sessions are always listed first.
+		The preferences are stored in the local state, and can be reset using the 'prefs reset' command.
+
+		Examples
+			c8y-session-bitwarden prefs
+			# List the hidden and pinned sessions
+	`),
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		prefs, err := state.LoadPrefs()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PREFERENCE\tSESSIONURI")
+		for _, uri := range prefs.Pinned {
+			fmt.Fprintf(w, "pinned\t%s\n", uri)
+		}
+		for _, uri := range prefs.Hidden {
+			fmt.Fprintf(w, "hidden\t%s\n", uri)
+		}
+		return w.Flush()
+	},
+}
+
+// prefsResetCmd represents the prefs reset command
+var prefsResetCmd = &cobra.Command{
+	Use:   "reset [SESSION_URI...]",
+	Short: "Reset the hidden and pinned sessions",
+	Long: heredoc.Doc(`
+		Unhide and unpin sessions. If no sessions are given, then the preferences of all sessions are reset.
+
+		Examples
+			c8y-session-bitwarden prefs reset
+			# Unhide and unpin all sessions
+
+			c8y-session-bitwarden prefs reset bitwarden://2b4e1c2a-58a6-4fb2-8b3c-b1a400a6f2e1
+			# Unhide and unpin a single session
+	`),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		prefs, err := state.LoadPrefs()
+		if err != nil {
+			return err
+		}
+		if len(args) == 0 {
+			prefs.Reset()
+		} else {
+			prefs.Remove(args...)
+		}
+		return prefs.Save()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(prefsCmd)
+	prefsCmd.AddCommand(prefsResetCmd)
+}
+
+// addShowHiddenFlag adds the flag used to include the hidden sessions
+func addShowHiddenFlag(cmd *cobra.Command) {
+	cmd.Flags().Bool("show-hidden", false, "Include sessions which were hidden in the picker")
+}
+
+// loadPrefs returns the hidden and pinned sessions. Nil is returned if the preferences can not be read
+func loadPrefs() *state.Prefs {
+	prefs, err := state.LoadPrefs()
+	if err != nil {
+		slog.Warn("Could not load the preferences.", "err", err)
+		return nil
+	}
+	return prefs
+}
+
+// applyPrefs removes the hidden sessions (unless showHidden is set), and moves the pinned sessions to the top
+func applyPrefs(prefs *state.Prefs, sessions []*core.CumulocitySession, showHidden bool) []*core.CumulocitySession {
+	if prefs == nil {
+		return sessions
+	}
+	if !showHidden {
+		sessions = prefs.Filter(sessions)
+	}
+	prefs.Sort(sessions)
+	return sessions
+}
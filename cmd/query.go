@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"log/slog"
+
+	"github.com/reubenmiller/c8y-session-bitwarden/pkg/core"
+)
+
+// parseSearchTerms parses the search terms given as arguments, and logs any warnings of the query,
+// e.g. a likely typo of a field qualifier which is matched as text instead
+func parseSearchTerms(args []string) (*core.Query, error) {
+	query, err := core.ParseQueryTerms(args...)
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range query.Warnings() {
+		slog.Warn("Search query: "+w.Message, "position", w.Position+1)
+	}
+	return query, nil
+}
@@ -1,8 +1,11 @@
 package bitwarden
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"os/exec"
@@ -11,12 +14,20 @@ import (
 	"time"
 
 	"github.com/cli/safeexec"
-	"github.com/pquerna/otp/totp"
 	session "github.com/reubenmiller/c8y-session-bitwarden/pkg/core"
 )
 
+// ErrNotFound is returned when an item does not exist
+var ErrNotFound = errors.New("not found")
+
+// ErrConflict is returned when an item was modified by someone else whilst it was being edited
+var ErrConflict = errors.New("item was modified in the meantime")
+
 type Client struct {
 	Folder string
+
+	// Fuzzy enables typo-tolerant matching of the search terms
+	Fuzzy bool
 }
 
 func NewClient(folder string) *Client {
@@ -36,11 +47,14 @@ func GetField(fields []BWField, name string) (string, bool) {
 
 // BWItem bitwarden item containing the login information
 type BWItem struct {
-	ID       string    `json:"id"`
-	Name     string    `json:"name"`
-	Login    BWLogin   `json:"login"`
-	Fields   []BWField `json:"fields"`
-	FolderID string    `json:"folderId"`
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Notes        string    `json:"notes"`
+	Login        BWLogin   `json:"login"`
+	Fields       []BWField `json:"fields"`
+	FolderID     string    `json:"folderId"`
+	Organization string    `json:"organizationId"`
+	RevisionDate string    `json:"revisionDate"`
 }
 
 func (bwi *BWItem) Skip() bool {
@@ -79,12 +93,16 @@ type BWUri struct {
 func mapToSession(item *BWItem, folders map[string]string) *session.CumulocitySession {
 
 	out := &session.CumulocitySession{
-		SessionURI: fmt.Sprintf("bitwarden://%s", item.ID),
-		Name:       item.Name,
-		Username:   item.Login.Username,
-		Password:   item.Login.Password,
-		FolderID:   item.FolderID,
-		TOTPSecret: item.Login.TOTPSecret,
+		SessionURI:     fmt.Sprintf("bitwarden://%s", item.ID),
+		Name:           item.Name,
+		Username:       item.Login.Username,
+		Password:       item.Login.Password,
+		FolderID:       item.FolderID,
+		OrganizationID: item.Organization,
+		TOTPSecret:     item.Login.TOTPSecret,
+
+		Notes:        item.Notes,
+		RevisionDate: item.RevisionDate,
 	}
 
 	// Include folder name (for humans)
@@ -95,6 +113,17 @@ func mapToSession(item *BWItem, folders map[string]string) *session.CumulocitySe
 	if len(item.Login.Uris) > 0 {
 		out.Host = item.Login.Uris[0].URI
 	}
+	for _, uri := range item.Login.Uris {
+		out.URIs = append(out.URIs, uri.URI)
+	}
+
+	// Keep the stored values of the editable fields, as the mode and login type are normalised
+	out.Fields = make(map[string]string)
+	for _, name := range session.EditableFields {
+		if v, found := GetField(item.Fields, name); found {
+			out.Fields[name] = v
+		}
+	}
 
 	if len(item.Fields) > 0 {
 		slog.Debug("Found custom fields", "id", item.ID, "fields", item.Fields)
@@ -111,7 +140,12 @@ func mapToSession(item *BWItem, folders map[string]string) *session.CumulocitySe
 		}
 
 		if v, found := GetField(item.Fields, "loginType"); found {
-			out.LoginType = v
+			loginType, typeErr := session.MarshalLoginType(v)
+			if typeErr != nil {
+				slog.Warn("Unknown login type, so using the value as is.", "got", v)
+				loginType = v
+			}
+			out.LoginType = loginType
 		}
 	} else {
 		slog.Debug("No fields found for item")
@@ -162,16 +196,71 @@ func (c *Client) ListFolders(name ...string) (map[string]string, error) {
 	return folderMap, err
 }
 
-func (c *Client) exec(args []string, data any) error {
-	if _, err := safeexec.LookPath("bw"); err != nil {
-		return err
+type Organization struct {
+	Object string `json:"object"`
+	Name   string `json:"name"`
+	ID     string `json:"id"`
+}
+
+// ListOrganizations returns the names of the organizations the user is a member of by id
+func (c *Client) ListOrganizations() (map[string]string, error) {
+	organizations := make([]Organization, 0)
+	err := c.exec([]string{"list", "organizations"}, &organizations)
+
+	organizationMap := make(map[string]string)
+	for _, organization := range organizations {
+		organizationMap[organization.ID] = organization.Name
 	}
+	return organizationMap, err
+}
 
-	if v := os.Getenv("BW_SESSION"); v == "" {
-		return fmt.Errorf("bitwarden cli 'BW_SESSION' env variable is not set")
+// itemNames looks up the folder and organization names of the items the first time they are needed,
+// as each bw call takes several hundred milliseconds. The names are only used for display purposes,
+// so any errors are ignored
+type itemNames struct {
+	client        *Client
+	folders       map[string]string
+	organizations map[string]string
+}
+
+// toSession maps the item to a session, including the names of its folder and organization
+func (n *itemNames) toSession(item *BWItem) *session.CumulocitySession {
+	if item.FolderID != "" && n.folders == nil {
+		n.folders, _ = n.client.ListFolders()
+	}
+	if item.Organization != "" && n.organizations == nil {
+		n.organizations, _ = n.client.ListOrganizations()
+	}
+	out := mapToSession(item, n.folders)
+	out.OrganizationName = n.organizations[item.Organization]
+	return out
+}
+
+func (c *Client) exec(args []string, data any) error {
+	return c.execInput(args, "", data)
+}
+
+// execInput runs a bw command which reads its input from stdin (e.g. an encoded item), and decodes its json output.
+// Secrets must be passed via stdin rather than as arguments, as arguments are visible to other users in the process list
+func (c *Client) execInput(args []string, stdin string, data any) error {
+	return c.execDecode(args, stdin, func(dec *json.Decoder) error {
+		return dec.Decode(data)
+	})
+}
+
+// execDecode runs a bw command and passes its json output to the decode function, which
+// allows the output to be processed whilst it is being read. The stdin is optional
+func (c *Client) execDecode(args []string, stdin string, decode func(dec *json.Decoder) error) error {
+	if err := checkCLI(); err != nil {
+		return err
 	}
 
 	bw := exec.Command("bw", args...)
+	if stdin != "" {
+		bw.Stdin = strings.NewReader(stdin)
+	}
+	stderr := &bytes.Buffer{}
+	bw.Stderr = stderr
 	stdout, err := bw.StdoutPipe()
 	if err != nil {
 		return err
@@ -180,18 +269,142 @@ func (c *Client) exec(args []string, data any) error {
 	if err != nil {
 		return err
 	}
-	parseErr := json.NewDecoder(stdout).Decode(data)
+	parseErr := decode(json.NewDecoder(stdout))
 	if parseErr != nil {
-		parseErr = fmt.Errorf("failed to parse json output. %w", parseErr)
+		// Prefer the error message from bw, e.g. "Not found.". The remaining output is read first,
+		// otherwise bw could block on a full pipe and never exit
+		io.Copy(io.Discard, stdout)
+		bw.Wait()
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			if strings.EqualFold(strings.TrimSuffix(msg, "."), "not found") {
+				return fmt.Errorf("bw %s failed. %w", strings.Join(args[:min(2, len(args))], " "), ErrNotFound)
+			}
+			return fmt.Errorf("bw %s failed. %s", strings.Join(args[:min(2, len(args))], " "), msg)
+		}
+		return fmt.Errorf("failed to parse json output. %w", parseErr)
 	}
 
 	// wait for command to finish in background
 	go bw.Wait()
 
-	return parseErr
+	return nil
+}
+
+// checkCLI checks if the bw cli is installed and unlocked
+func checkCLI() error {
+	if _, err := safeexec.LookPath("bw"); err != nil {
+		return err
+	}
+
+	if v := os.Getenv("BW_SESSION"); v == "" {
+		return fmt.Errorf("bitwarden cli 'BW_SESSION' env variable is not set")
+	}
+	return nil
+}
+
+// run runs a bw command which does not return json (e.g. bw sync), and returns its trimmed output
+func (c *Client) run(args []string, stdin string) (string, error) {
+	if err := checkCLI(); err != nil {
+		return "", err
+	}
+
+	bw := exec.Command("bw", args...)
+	if stdin != "" {
+		bw.Stdin = strings.NewReader(stdin)
+	}
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	bw.Stdout = stdout
+	bw.Stderr = stderr
+	if err := bw.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("bw %s failed. %s", strings.Join(args[:min(2, len(args))], " "), msg)
+		}
+		return "", fmt.Errorf("bw %s failed. %w", strings.Join(args[:min(2, len(args))], " "), err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// Sync pulls the latest changes of the vault from the server, e.g. items which were shared recently
+func (c *Client) Sync() error {
+	_, err := c.run([]string{"sync"}, "")
+	return err
 }
 
+// ParseSessionRef returns the bitwarden item id (or id prefix) from a session reference.
+// The reference can be a SessionURI (bitwarden://<id>), an item id or an item id prefix
+func ParseSessionRef(ref string) string {
+	return strings.TrimPrefix(strings.TrimSpace(ref), "bitwarden://")
+}
+
+// Get returns a single session by its SessionURI, item id or a unique item id prefix.
+// Unlike List, the folder filter of the client is not applied
+func (c *Client) Get(ref string) (*session.CumulocitySession, error) {
+	id := ParseSessionRef(ref)
+	if id == "" {
+		return nil, fmt.Errorf("session reference is empty")
+	}
+
+	item := &BWItem{}
+	if isUID(id) {
+		if err := c.exec([]string{"get", "item", id}, item); err != nil {
+			return nil, err
+		}
+	} else {
+		// bw get item does not support id prefixes, so match client side
+		items := make([]BWItem, 0)
+		if err := c.exec([]string{"list", "items"}, &items); err != nil {
+			return nil, err
+		}
+		matches := make([]BWItem, 0)
+		for _, v := range items {
+			if strings.HasPrefix(strings.ToLower(v.ID), strings.ToLower(id)) {
+				matches = append(matches, v)
+			}
+		}
+		switch len(matches) {
+		case 0:
+			return nil, fmt.Errorf("no item found matching id prefix: %s. %w", id, ErrNotFound)
+		case 1:
+			item = &matches[0]
+		default:
+			return nil, fmt.Errorf("id prefix is ambiguous. prefix=%s, matches=%d", id, len(matches))
+		}
+	}
+
+	if item.Skip() {
+		return nil, fmt.Errorf("item does not have any uris. id=%s", item.ID)
+	}
+
+	names := &itemNames{client: c}
+	return names.toSession(item), nil
+}
+
+// streamBatchSize is the number of sessions which are collected before they are streamed to the caller
+const streamBatchSize = 20
+
+// List returns the sessions matching the search terms sorted by their relevance. The search terms
+// are parsed using the query language supported by session.ParseQuery
 func (c *Client) List(name ...string) ([]*session.CumulocitySession, error) {
+	return c.ListWithProgress(nil, nil, name...)
+}
+
+// ListWithProgress returns the sessions matching the search terms like List. The progress function
+// is called with a short description of the current step (e.g. "decrypting items"), and the stream function
+// is called with batches of the matching sessions as they are read (before they are sorted). Both functions are optional
+func (c *Client) ListWithProgress(progress func(status string), stream func(sessions []*session.CumulocitySession), name ...string) ([]*session.CumulocitySession, error) {
+	report := func(status string) {
+		if progress != nil {
+			progress(status)
+		}
+	}
+
+	query, err := session.ParseQueryTerms(name...)
+	if err != nil {
+		return nil, err
+	}
+	query.Fuzzy = c.Fuzzy
+
 	cmdArgs := []string{
 		"list", "items",
 	}
@@ -205,6 +418,7 @@ func (c *Client) List(name ...string) ([]*session.CumulocitySession, error) {
 			cmdArgs = append(cmdArgs, "--folderid", c.Folder)
 		} else {
 			// Filter by folder name/pattern (additional lookup required)
+			report("fetching folders")
 			folders, folderErr = c.ListFolders(c.Folder)
 			if folderErr != nil {
 				return nil, folderErr
@@ -212,54 +426,178 @@ func (c *Client) List(name ...string) ([]*session.CumulocitySession, error) {
 		}
 	}
 
+	// The folders which were required for filtering are reused for the folder names. The names are
+	// set before the sessions are streamed, as the sessions must not be modified afterwards
+	names := &itemNames{client: c, folders: folders}
+
 	// TODO: Make it configurable if the bw filtering should be used or not
-	if len(name) > 0 {
-		// Only add first search terms the bw cli command only supports one,
+	// Fuzzy matches would be excluded by the bw search
+	if term := query.SearchTerm(); term != "" && !c.Fuzzy {
+		// Only add one plain search term as the bw cli command only supports one,
 		// the remaining of the searching will be done client side
-		cmdArgs = append(cmdArgs, "--search", name[0])
+		cmdArgs = append(cmdArgs, "--search", term)
 	}
 
 	slog.Debug("Starting", "time", time.Now().Format(time.RFC3339Nano))
 
-	items := make([]BWItem, 0)
-	c.exec(cmdArgs, &items)
-
+	report("decrypting items")
 	sessions := make([]*session.CumulocitySession, 0)
-	for _, item := range items {
-		if item.Skip() {
-			continue
+	batch := make([]*session.CumulocitySession, 0, streamBatchSize)
+	flush := func() {
+		if stream != nil && len(batch) > 0 {
+			stream(batch)
 		}
+		batch = make([]*session.CumulocitySession, 0, streamBatchSize)
+	}
 
-		if len(folders) > 0 {
-			if _, found := folders[item.FolderID]; !found {
+	err = c.execDecode(cmdArgs, "", func(dec *json.Decoder) error {
+		// Decode the items one by one so that they can be streamed
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+		for dec.More() {
+			item := BWItem{}
+			if err := dec.Decode(&item); err != nil {
+				return err
+			}
+			if item.Skip() {
 				continue
 			}
-		}
 
-		currentSession := mapToSession(&item, folders)
+			if len(folders) > 0 {
+				if _, found := folders[item.FolderID]; !found {
+					continue
+				}
+			}
 
-		// apply client side filtering
-		if session.MatchSession(currentSession, name...) {
+			// apply client side filtering
+			currentSession := names.toSession(&item)
+			if _, ok := query.Rank(currentSession); !ok {
+				continue
+			}
 			sessions = append(sessions, currentSession)
+			batch = append(batch, currentSession)
+			if len(batch) >= streamBatchSize {
+				flush()
+				report(fmt.Sprintf("loading items (%d)", len(sessions)))
+			}
 		}
+		_, err := dec.Token()
+		return err
+	})
+	flush()
+	if err != nil {
+		return nil, err
+	}
+
+	// sort by relevance
+	ranked := session.RankSessions(query, sessions)
+	sessions = make([]*session.CumulocitySession, 0, len(ranked))
+	for _, r := range ranked {
+		sessions = append(sessions, r.Session)
 	}
 	return sessions, nil
 }
 
-func GetTOTPCode(secret string, t time.Time) (string, error) {
-	if t.Year() == 0 {
-		t = time.Now()
+// Edit changes the metadata (name, uris and custom fields) of a session. The item is read and written back as is,
+// so any other properties of the item are preserved. If revisionDate is set, then ErrConflict is
+// returned if the item has been modified since then
+func (c *Client) Edit(ref string, revisionDate string, edit *session.SessionEdit) (*session.CumulocitySession, error) {
+	id := ParseSessionRef(ref)
+	if id == "" {
+		return nil, fmt.Errorf("session reference is empty")
+	}
+	if err := edit.Validate(); err != nil {
+		return nil, err
+	}
+
+	raw := make(map[string]any)
+	if err := c.exec([]string{"get", "item", id}, &raw); err != nil {
+		return nil, err
+	}
+	if current, _ := raw["revisionDate"].(string); revisionDate != "" && current != revisionDate {
+		return nil, fmt.Errorf("%w. last modified=%s", ErrConflict, current)
+	}
+
+	login, ok := raw["login"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("item is not a login item. id=%s", id)
 	}
-	return totp.GenerateCode(secret, t)
+
+	raw["name"] = edit.Name
+
+	// Keep the uri match settings of the existing uris
+	existingUris, _ := login["uris"].([]any)
+	uris := make([]any, 0, len(edit.URIs))
+	for i, uri := range edit.URIs {
+		entry := map[string]any{"match": nil}
+		if i < len(existingUris) {
+			if existing, ok := existingUris[i].(map[string]any); ok {
+				entry = existing
+			}
+		}
+		entry["uri"] = uri
+		uris = append(uris, entry)
+	}
+	login["uris"] = uris
+
+	existingFields, _ := raw["fields"].([]any)
+	for _, name := range session.EditableFields {
+		value, found := edit.Fields[name]
+		if !found {
+			continue
+		}
+		fields := make([]any, 0, len(existingFields)+1)
+		set := false
+		for _, f := range existingFields {
+			if field, ok := f.(map[string]any); ok {
+				if fieldName, _ := field["name"].(string); strings.EqualFold(fieldName, name) {
+					if value == "" || set {
+						// Remove the field (or any duplicates)
+						continue
+					}
+					field["value"] = value
+					set = true
+				}
+			}
+			fields = append(fields, f)
+		}
+		if !set && value != "" {
+			// Add as a text field
+			fields = append(fields, map[string]any{"name": name, "value": value, "type": 0})
+		}
+		existingFields = fields
+	}
+	raw["fields"] = existingFields
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := c.run([]string{"encode"}, string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	item := &BWItem{}
+	if err := c.execInput([]string{"edit", "item", id}, encoded, item); err != nil {
+		return nil, err
+	}
+
+	names := &itemNames{client: c}
+	return names.toSession(item), nil
+}
+
+// GetTOTPCode returns the TOTP code of the secret at the given time.
+//
+// Deprecated: use core.GetTOTPCode
+func GetTOTPCode(secret string, t time.Time) (string, error) {
+	return session.GetTOTPCode(secret, t)
 }
 
+// GetTOTPCodeFromSecret returns the current TOTP code of the secret (or the next code if the current one expires within 5 seconds).
+//
+// Deprecated: use core.GetTOTPCodeFromSecret
 func GetTOTPCodeFromSecret(secret string) (string, error) {
-	now := time.Now()
-	totpTime := now
-	totpPeriod := 30
-	totpNextTransition := totpPeriod - now.Second()%30
-	if totpNextTransition < 5 {
-		totpTime = now.Add(30 * time.Second)
-	}
-	return GetTOTPCode(secret, totpTime)
+	return session.GetTOTPCodeFromSecret(secret)
 }
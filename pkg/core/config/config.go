@@ -0,0 +1,59 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// EnvConfigFile can be used to override the path of the config file
+const EnvConfigFile = "C8Y_SESSION_BITWARDEN_CONFIG"
+
+// Config contains the user settings, e.g. the theme and key bindings of the picker
+type Config struct {
+	// Theme is the name of the theme preset used by the picker
+	Theme string `json:"theme,omitempty"`
+
+	// Colors overrides individual colours of the theme, e.g. {"title": "#FFFFFF"}
+	Colors map[string]string `json:"colors,omitempty"`
+
+	// KeyMap is the name of the key binding preset used by the picker
+	KeyMap string `json:"keymap,omitempty"`
+
+	// Keys overrides the keys of individual actions, e.g. {"cancel": ["esc", "ctrl+c"]}
+	Keys map[string][]string `json:"keys,omitempty"`
+}
+
+// Path returns the path of the config file
+func Path() (string, error) {
+	if v := os.Getenv(EnvConfigFile); v != "" {
+		return v, nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "c8y-session-bitwarden", "config.json"), nil
+}
+
+// Load reads the config file. An empty config is returned if the file does not exist
+func Load() (*Config, error) {
+	path, err := Path()
+	if err != nil {
+		return nil, err
+	}
+	c := &Config{}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return c, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(contents, c); err != nil {
+		return nil, fmt.Errorf("invalid config file. path=%s, err=%w", path, err)
+	}
+	return c, nil
+}
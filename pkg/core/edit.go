@@ -0,0 +1,97 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Names of the custom fields which are mapped to session properties
+const (
+	FieldTenant    = "tenant"
+	FieldMode      = "mode"
+	FieldLoginType = "loginType"
+)
+
+// EditableFields lists the custom fields which can be edited
+var EditableFields = []string{FieldTenant, FieldMode, FieldLoginType}
+
+// SessionEdit contains the editable metadata of a session
+type SessionEdit struct {
+	Name string
+	URIs []string
+
+	// Fields are the values of the custom fields by name (see EditableFields). An empty value removes the field
+	Fields map[string]string
+}
+
+// NewSessionEdit returns the editable metadata of the session. The custom fields use the values
+// as they are stored (if known), e.g. an unknown mode is not changed to prod
+func NewSessionEdit(s *CumulocitySession) *SessionEdit {
+	uris := s.URIs
+	if len(uris) == 0 && s.Host != "" {
+		uris = []string{s.Host}
+	}
+	fields := map[string]string{
+		FieldTenant:    s.Tenant,
+		FieldMode:      s.Mode,
+		FieldLoginType: s.LoginType,
+	}
+	if s.Fields != nil {
+		for _, name := range EditableFields {
+			fields[name] = s.Fields[name]
+		}
+	}
+	return &SessionEdit{
+		Name:   s.Name,
+		URIs:   append([]string{}, uris...),
+		Fields: fields,
+	}
+}
+
+// RemoveUnchangedFields removes the custom fields which still have the value of the session,
+// so that only the fields which were changed are written back
+func (e *SessionEdit) RemoveUnchangedFields(s *CumulocitySession) {
+	original := NewSessionEdit(s)
+	for name, value := range e.Fields {
+		if value == original.Fields[name] {
+			delete(e.Fields, name)
+		}
+	}
+}
+
+// Validate checks and normalizes the values, e.g. the mode "production" is changed to "prod"
+func (e *SessionEdit) Validate() error {
+	if strings.TrimSpace(e.Name) == "" {
+		return fmt.Errorf("name must not be empty")
+	}
+
+	uris := make([]string, 0, len(e.URIs))
+	for _, uri := range e.URIs {
+		if uri = strings.TrimSpace(uri); uri != "" {
+			uris = append(uris, uri)
+		}
+	}
+	if len(uris) == 0 {
+		return fmt.Errorf("at least one uri is required")
+	}
+	e.URIs = uris
+
+	if v := strings.TrimSpace(e.Fields[FieldMode]); v != "" {
+		mode, err := MarshalSessionType(v)
+		if err != nil {
+			return fmt.Errorf("%w. allowed values: %s", err, strings.Join([]string{TypeDev, TypeQual, TypeProduction}, ", "))
+		}
+		e.Fields[FieldMode] = mode
+	}
+	if v := strings.TrimSpace(e.Fields[FieldLoginType]); v != "" {
+		loginType, err := MarshalLoginType(v)
+		if err != nil {
+			return fmt.Errorf("%w. allowed values: %s", err, strings.Join(LoginTypes, ", "))
+		}
+		e.Fields[FieldLoginType] = loginType
+	}
+	if v, found := e.Fields[FieldTenant]; found {
+		e.Fields[FieldTenant] = strings.TrimSpace(v)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package format
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/reubenmiller/c8y-session-bitwarden/pkg/core"
+)
+
+const (
+	FormatJSON       = "json"
+	FormatYAML       = "yaml"
+	FormatDotEnv     = "dotenv"
+	FormatBash       = "bash"
+	FormatZsh        = "zsh"
+	FormatFish       = "fish"
+	FormatPowerShell = "powershell"
+)
+
+// Formats lists all supported output formats
+var Formats = []string{
+	FormatJSON,
+	FormatYAML,
+	FormatDotEnv,
+	FormatBash,
+	FormatZsh,
+	FormatFish,
+	FormatPowerShell,
+}
+
+// envVar maps a session value to a go-c8y-cli environment variable
+type envVar struct {
+	Name  string
+	Value string
+}
+
+func sessionEnv(s *core.CumulocitySession) []envVar {
+	return []envVar{
+		{"C8Y_HOST", s.Host},
+		{"C8Y_TENANT", s.Tenant},
+		{"C8Y_USER", s.Username},
+		{"C8Y_PASSWORD", s.Password},
+		{"C8Y_TOTP", s.TOTP},
+	}
+}
+
+// Write writes the session to w using the given output format
+func Write(w io.Writer, format string, s *core.CumulocitySession) error {
+	switch strings.ToLower(format) {
+	case "", FormatJSON:
+		out, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", out)
+		return err
+	case FormatYAML:
+		return writeYAML(w, s)
+	case FormatDotEnv:
+		return writeEnv(w, s, "%s=%s\n", "%s=''\n", QuoteDotEnv)
+	case FormatBash, FormatZsh:
+		return writeEnv(w, s, "export %s=%s\n", "unset %s\n", QuotePOSIX)
+	case FormatFish:
+		return writeEnv(w, s, "set -gx %s %s\n", "set -e %s\n", QuoteFish)
+	case FormatPowerShell:
+		return writeEnv(w, s, "$env:%s = %s\n", "Remove-Item Env:%s -ErrorAction SilentlyContinue\n", QuotePowerShell)
+	default:
+		return fmt.Errorf("unknown output format: %s. allowed values: %s", format, strings.Join(Formats, ", "))
+	}
+}
+
+// WriteAll writes several sessions using the given format. The json format is written as an array,
+// the yaml format as multiple documents, and the other formats as one block per session (separated by a comment)
+func WriteAll(w io.Writer, format string, sessions []*core.CumulocitySession) error {
+	switch strings.ToLower(format) {
+	case "", FormatJSON:
+		out, err := json.MarshalIndent(sessions, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", out)
+		return err
+	case FormatYAML:
+		for _, s := range sessions {
+			if _, err := fmt.Fprintln(w, "---"); err != nil {
+				return err
+			}
+			if err := writeYAML(w, s); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if !slices.Contains(Formats, strings.ToLower(format)) {
+		return fmt.Errorf("unknown output format: %s. allowed values: %s", format, strings.Join(Formats, ", "))
+	}
+	for i, s := range sessions {
+		if i > 0 {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		// All of the env formats support # comments
+		if _, err := fmt.Fprintf(w, "# %s\n", strings.ReplaceAll(s.SessionURI, "\n", " ")); err != nil {
+			return err
+		}
+		if err := Write(w, format, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeEnv writes the environment variables of the session. Empty variables are unset (using the unset layout),
+// so that values of a previously activated session (e.g. C8Y_TOTP) are not kept
+func writeEnv(w io.Writer, s *core.CumulocitySession, layout string, unset string, quote func(string) string) error {
+	for _, v := range sessionEnv(s) {
+		if v.Value == "" {
+			if _, err := fmt.Fprintf(w, unset, v.Name); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := fmt.Fprintf(w, layout, v.Name, quote(v.Value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// field is a single session value along with its json name
+type field struct {
+	Name      string
+	Value     string
+	OmitEmpty bool
+}
+
+// sessionFields returns the session values in the order of the struct fields, using the json
+// field names so that all formats use consistent naming
+func sessionFields(s *core.CumulocitySession) []field {
+	v := reflect.ValueOf(*s)
+	t := v.Type()
+	fields := make([]field, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, opts, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		fields = append(fields, field{
+			Name:      name,
+			Value:     fmt.Sprintf("%v", v.Field(i).Interface()),
+			OmitEmpty: strings.Contains(opts, "omitempty"),
+		})
+	}
+	return fields
+}
+
+// writeYAML writes a flat yaml mapping using the json field names of the session.
+// Values are always double-quoted, and the go escape sequences produced by strconv.Quote
+// are a subset of the ones supported by yaml
+func writeYAML(w io.Writer, s *core.CumulocitySession) error {
+	for _, f := range sessionFields(s) {
+		if f.Value == "" && f.OmitEmpty {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "%s: %s\n", f.Name, strconv.Quote(f.Value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// QuotePOSIX quotes a value for bash/zsh using single quotes
+func QuotePOSIX(v string) string {
+	return "'" + strings.ReplaceAll(v, "'", `'\''`) + "'"
+}
+
+// QuoteFish quotes a value for fish using single quotes. Only backslashes and single quotes
+// need escaping inside single quotes in fish
+func QuoteFish(v string) string {
+	r := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	return "'" + r.Replace(v) + "'"
+}
+
+// QuotePowerShell quotes a value for PowerShell using a verbatim (single quoted) string. PowerShell also
+// treats the typographic single quotes (e.g. ‘ and ’) as quotes, so they are doubled as well
+func QuotePowerShell(v string) string {
+	r := strings.NewReplacer("'", "''", "\u2018", "\u2018\u2018", "\u2019", "\u2019\u2019", "\u201A", "\u201A\u201A", "\u201B", "\u201B\u201B")
+	return "'" + r.Replace(v) + "'"
+}
+
+// QuoteDotEnv quotes a value for a dotenv file. Single quotes are used where possible
+// as they are not subject to variable expansion
+func QuoteDotEnv(v string) string {
+	if !strings.ContainsAny(v, "'\n\r") {
+		return "'" + v + "'"
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "`", "\\`", "\n", `\n`, "\r", `\r`)
+	return `"` + r.Replace(v) + `"`
+}
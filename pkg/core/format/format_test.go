@@ -0,0 +1,148 @@
+package format
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/reubenmiller/c8y-session-bitwarden/pkg/core"
+)
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		name       string
+		value      string
+		posix      string
+		fish       string
+		powershell string
+		dotenv     string
+	}{
+		{
+			name:       "plain",
+			value:      "secret",
+			posix:      `'secret'`,
+			fish:       `'secret'`,
+			powershell: `'secret'`,
+			dotenv:     `'secret'`,
+		},
+		{
+			name:       "empty",
+			value:      "",
+			posix:      `''`,
+			fish:       `''`,
+			powershell: `''`,
+			dotenv:     `''`,
+		},
+		{
+			name:       "single quote",
+			value:      `it's`,
+			posix:      `'it'\''s'`,
+			fish:       `'it\'s'`,
+			powershell: `'it''s'`,
+			dotenv:     `"it's"`,
+		},
+		{
+			name:       "double quote",
+			value:      `say "hi"`,
+			posix:      `'say "hi"'`,
+			fish:       `'say "hi"'`,
+			powershell: `'say "hi"'`,
+			dotenv:     `'say "hi"'`,
+		},
+		{
+			name:       "backslash",
+			value:      `a\b\`,
+			posix:      `'a\b\'`,
+			fish:       `'a\\b\\'`,
+			powershell: `'a\b\'`,
+			dotenv:     `'a\b\'`,
+		},
+		{
+			name:       "variable",
+			value:      "$HOME`pwd`$(id)",
+			posix:      "'$HOME`pwd`$(id)'",
+			fish:       "'$HOME`pwd`$(id)'",
+			powershell: "'$HOME`pwd`$(id)'",
+			dotenv:     "'$HOME`pwd`$(id)'",
+		},
+		{
+			name:       "single quote and variable",
+			value:      "it's $HOME`pwd`\\",
+			posix:      `'it'\''s $HOME` + "`pwd`" + `\'`,
+			fish:       `'it\'s $HOME` + "`pwd`" + `\\'`,
+			powershell: `'it''s $HOME` + "`pwd`" + `\'`,
+			dotenv:     `"it's \$HOME` + "\\`pwd\\`" + `\\"`,
+		},
+		{
+			name:       "newline",
+			value:      "line1\nline2\r",
+			posix:      "'line1\nline2\r'",
+			fish:       "'line1\nline2\r'",
+			powershell: "'line1\nline2\r'",
+			dotenv:     `"line1\nline2\r"`,
+		},
+		{
+			name:       "unicode quotes",
+			value:      "‘a’ ‚b‛ “c”",
+			posix:      "'‘a’ ‚b‛ “c”'",
+			fish:       "'‘a’ ‚b‛ “c”'",
+			powershell: "'‘‘a’’ ‚‚b‛‛ “c”'",
+			dotenv:     "'‘a’ ‚b‛ “c”'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := QuotePOSIX(tt.value); got != tt.posix {
+				t.Errorf("QuotePOSIX: got %s, want %s", got, tt.posix)
+			}
+			if got := QuoteFish(tt.value); got != tt.fish {
+				t.Errorf("QuoteFish: got %s, want %s", got, tt.fish)
+			}
+			if got := QuotePowerShell(tt.value); got != tt.powershell {
+				t.Errorf("QuotePowerShell: got %s, want %s", got, tt.powershell)
+			}
+			if got := QuoteDotEnv(tt.value); got != tt.dotenv {
+				t.Errorf("QuoteDotEnv: got %s, want %s", got, tt.dotenv)
+			}
+		})
+	}
+}
+
+func TestWriteUnsetsEmptyVariables(t *testing.T) {
+	s := &core.CumulocitySession{
+		Host:     "https://example.com",
+		Username: "admin",
+		Password: "secret",
+	}
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{
+			format: FormatBash,
+			want:   "export C8Y_HOST='https://example.com'\nunset C8Y_TENANT\nexport C8Y_USER='admin'\nexport C8Y_PASSWORD='secret'\nunset C8Y_TOTP\n",
+		},
+		{
+			format: FormatFish,
+			want:   "set -gx C8Y_HOST 'https://example.com'\nset -e C8Y_TENANT\nset -gx C8Y_USER 'admin'\nset -gx C8Y_PASSWORD 'secret'\nset -e C8Y_TOTP\n",
+		},
+		{
+			format: FormatPowerShell,
+			want:   "$env:C8Y_HOST = 'https://example.com'\nRemove-Item Env:C8Y_TENANT -ErrorAction SilentlyContinue\n$env:C8Y_USER = 'admin'\n$env:C8Y_PASSWORD = 'secret'\nRemove-Item Env:C8Y_TOTP -ErrorAction SilentlyContinue\n",
+		},
+		{
+			format: FormatDotEnv,
+			want:   "C8Y_HOST='https://example.com'\nC8Y_TENANT=''\nC8Y_USER='admin'\nC8Y_PASSWORD='secret'\nC8Y_TOTP=''\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			out := &strings.Builder{}
+			if err := Write(out, tt.format, s); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package format
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/reubenmiller/c8y-session-bitwarden/pkg/core"
+)
+
+const (
+	ListFormatTable = "table"
+	ListFormatJSONL = "jsonl"
+	ListFormatCSV   = "csv"
+)
+
+// ListFormats lists the supported formats when writing multiple sessions
+var ListFormats = []string{
+	ListFormatTable,
+	ListFormatJSONL,
+	ListFormatCSV,
+}
+
+// DefaultColumns are the columns shown when listing sessions if no columns are given
+var DefaultColumns = []string{"name", "host", "tenant", "username", "mode", "folderName", "sessionUri"}
+
+// SecretColumns are the columns which contain sensitive information
+var SecretColumns = []string{"password", "totp", "totpSecret"}
+
+// Columns returns the names of all the columns which can be used when listing sessions
+func Columns() []string {
+	columns := make([]string, 0)
+	for _, f := range sessionFields(&core.CumulocitySession{}) {
+		columns = append(columns, f.Name)
+	}
+	return columns
+}
+
+// ResolveColumns validates the user provided column names (case-insensitive) and returns
+// the canonical names. Secret columns are rejected unless showSecrets is set
+func ResolveColumns(names []string, showSecrets bool) ([]string, error) {
+	if len(names) == 0 {
+		names = DefaultColumns
+	}
+	available := Columns()
+	columns := make([]string, 0, len(names))
+	for _, name := range names {
+		idx := slices.IndexFunc(available, func(c string) bool {
+			return strings.EqualFold(c, strings.TrimSpace(name))
+		})
+		if idx == -1 {
+			return nil, fmt.Errorf("unknown column: %s. allowed values: %s", name, strings.Join(available, ", "))
+		}
+		if !showSecrets && slices.Contains(SecretColumns, available[idx]) {
+			return nil, fmt.Errorf("column %s contains secrets and requires --show-secrets", available[idx])
+		}
+		columns = append(columns, available[idx])
+	}
+	return columns, nil
+}
+
+func rowValues(s *core.CumulocitySession, columns []string) []string {
+	fields := sessionFields(s)
+	row := make([]string, 0, len(columns))
+	for _, column := range columns {
+		value := ""
+		for _, f := range fields {
+			if f.Name == column {
+				value = f.Value
+				break
+			}
+		}
+		row = append(row, value)
+	}
+	return row
+}
+
+// WriteList writes multiple sessions to w using one of the list formats. Only the given columns are included
+func WriteList(w io.Writer, format string, sessions []*core.CumulocitySession, columns []string) error {
+	switch strings.ToLower(format) {
+	case "", ListFormatTable:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		header := make([]string, 0, len(columns))
+		for _, column := range columns {
+			header = append(header, strings.ToUpper(column))
+		}
+		fmt.Fprintln(tw, strings.Join(header, "\t"))
+		for _, s := range sessions {
+			fmt.Fprintln(tw, strings.Join(rowValues(s, columns), "\t"))
+		}
+		return tw.Flush()
+	case ListFormatJSONL:
+		for _, s := range sessions {
+			// Build the object manually to preserve the column order
+			values := rowValues(s, columns)
+			parts := make([]string, 0, len(columns))
+			for i, column := range columns {
+				k, _ := json.Marshal(column)
+				v, _ := json.Marshal(values[i])
+				parts = append(parts, string(k)+":"+string(v))
+			}
+			if _, err := fmt.Fprintf(w, "{%s}\n", strings.Join(parts, ",")); err != nil {
+				return err
+			}
+		}
+		return nil
+	case ListFormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(columns); err != nil {
+			return err
+		}
+		for _, s := range sessions {
+			if err := cw.Write(rowValues(s, columns)); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return fmt.Errorf("unknown output format: %s. allowed values: %s", format, strings.Join(ListFormats, ", "))
+	}
+}
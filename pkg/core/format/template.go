@@ -0,0 +1,76 @@
+package format
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"text/template"
+
+	"github.com/reubenmiller/c8y-session-bitwarden/pkg/core"
+)
+
+// templateFuncs returns the helper functions which are available to user defined templates.
+// Some helpers are bound to the session being rendered so they can be used without arguments
+func templateFuncs(s *core.CumulocitySession) template.FuncMap {
+	return template.FuncMap{
+		"quote":           QuotePOSIX,
+		"quoteFish":       QuoteFish,
+		"quotePowerShell": QuotePowerShell,
+		"quoteDotEnv":     QuoteDotEnv,
+		"b64enc": func(v string) string {
+			return base64.StdEncoding.EncodeToString([]byte(v))
+		},
+		"b64dec": func(v string) (string, error) {
+			out, err := base64.StdEncoding.DecodeString(v)
+			return string(out), err
+		},
+		"basicAuth": func() string {
+			return BasicAuth(s)
+		},
+		"totp": func() (string, error) {
+			if s.TOTP != "" || s.TOTPSecret == "" {
+				return s.TOTP, nil
+			}
+			return core.GetTOTPCodeFromSecret(s.TOTPSecret)
+		},
+	}
+}
+
+// BasicAuth returns the value of a basic authorization header for the session.
+// The username is prefixed with the tenant (if set), as expected by Cumulocity IoT
+func BasicAuth(s *core.CumulocitySession) string {
+	username := s.Username
+	if s.Tenant != "" {
+		username = s.Tenant + "/" + s.Username
+	}
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+s.Password))
+}
+
+// ParseTemplate parses a user defined template. The template can then be executed
+// against a session using WriteTemplate
+func ParseTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("session").Funcs(templateFuncs(&core.CumulocitySession{})).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template. %w", err)
+	}
+	return tmpl, nil
+}
+
+// ParseTemplateFile parses a user defined template from a file
+func ParseTemplateFile(path string) (*template.Template, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseTemplate(string(contents))
+}
+
+// WriteTemplate executes the template against a session and writes the result to w
+func WriteTemplate(w io.Writer, tmpl *template.Template, s *core.CumulocitySession) error {
+	clone, err := tmpl.Clone()
+	if err != nil {
+		return err
+	}
+	return clone.Funcs(templateFuncs(s)).Execute(w, s)
+}
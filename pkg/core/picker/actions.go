@@ -0,0 +1,80 @@
+package picker
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/atotto/clipboard"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// DefaultClipboardTimeout is the duration after which copied secrets are removed from the clipboard
+const DefaultClipboardTimeout = 30 * time.Second
+
+// statusMsg is used to show feedback of an action in the status bar
+type statusMsg struct {
+	text  string
+	isErr bool
+}
+
+// clipboardCopiedMsg is sent when a value was copied to the clipboard
+type clipboardCopiedMsg struct {
+	label  string
+	value  string
+	secret bool
+}
+
+// clipboardClearMsg is sent when a copied secret should be removed from the clipboard
+type clipboardClearMsg struct {
+	value string
+}
+
+func copyToClipboard(label string, value string, secret bool) tea.Cmd {
+	return func() tea.Msg {
+		if value == "" {
+			return statusMsg{text: fmt.Sprintf("No %s set", label), isErr: true}
+		}
+		if err := clipboard.WriteAll(value); err != nil {
+			return statusMsg{text: fmt.Sprintf("Could not copy %s. %s", label, err), isErr: true}
+		}
+		return clipboardCopiedMsg{label: label, value: value, secret: secret}
+	}
+}
+
+// clearClipboard removes the value from the clipboard, but only if the clipboard still
+// contains it (so that anything the user copied afterwards is left untouched)
+func clearClipboard(value string) {
+	if current, err := clipboard.ReadAll(); err == nil && current == value {
+		clipboard.WriteAll("")
+	}
+}
+
+// TenantURL returns the url of the Cumulocity IoT UI for the given host
+func TenantURL(host string) string {
+	if !strings.HasPrefix(host, "http://") && !strings.HasPrefix(host, "https://") {
+		host = "https://" + host
+	}
+	return host
+}
+
+func openBrowser(url string) tea.Cmd {
+	return func() tea.Msg {
+		var cmd *exec.Cmd
+		switch runtime.GOOS {
+		case "darwin":
+			cmd = exec.Command("open", url)
+		case "windows":
+			cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+		default:
+			cmd = exec.Command("xdg-open", url)
+		}
+		if err := cmd.Start(); err != nil {
+			return statusMsg{text: fmt.Sprintf("Could not open browser. %s", err), isErr: true}
+		}
+		go cmd.Wait()
+		return statusMsg{text: "Opened " + url}
+	}
+}
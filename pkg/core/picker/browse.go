@@ -0,0 +1,101 @@
+package picker
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/reubenmiller/c8y-session-bitwarden/pkg/core"
+)
+
+const (
+	collectionFolder       = "folder"
+	collectionOrganization = "organization"
+)
+
+// collection is a list item of a folder or organization used in the browse mode
+type collection struct {
+	kind  string
+	name  string
+	count int
+}
+
+// FilterValue allows the collections to be filtered by name
+func (c *collection) FilterValue() string { return c.name }
+
+// label returns the display text of the collection
+func (c *collection) label() string {
+	if c.kind == collectionOrganization {
+		return "Organization: " + c.name
+	}
+	return "Folder: " + c.name
+}
+
+// contains returns true if the session belongs to the collection
+func (c *collection) contains(s *core.CumulocitySession) bool {
+	if c.kind == collectionOrganization {
+		return s.OrganizationID != "" && s.OrganizationName == c.name
+	}
+	return groupKey(s, GroupByFolder) == c.name
+}
+
+// collectionItems returns the folders followed by the organizations of the sessions,
+// along with the number of sessions in each of them
+func collectionItems(sessions []*core.CumulocitySession) []list.Item {
+	counts := map[string]map[string]int{
+		collectionFolder:       {},
+		collectionOrganization: {},
+	}
+	for _, s := range sessions {
+		counts[collectionFolder][groupKey(s, GroupByFolder)]++
+		if s.OrganizationID != "" {
+			counts[collectionOrganization][s.OrganizationName]++
+		}
+	}
+
+	items := make([]list.Item, 0)
+	for _, kind := range []string{collectionFolder, collectionOrganization} {
+		names := make([]string, 0, len(counts[kind]))
+		for name := range counts[kind] {
+			names = append(names, name)
+		}
+		slices.SortFunc(names, func(a, b string) int {
+			return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+		})
+		for _, name := range names {
+			items = append(items, &collection{kind: kind, name: name, count: counts[kind][name]})
+		}
+	}
+	return items
+}
+
+// openCollection shows the sessions of the highlighted collection
+func (m *model) openCollection(c *collection) tea.Cmd {
+	m.collection = c
+	m.list.ResetFilter()
+	cmd := m.refreshItems()
+	m.list.Select(0)
+	if !m.loading && !m.refreshing {
+		m.list.Title = m.baseTitle()
+	}
+	return cmd
+}
+
+// closeCollection returns to the list of collections, and highlights the previously opened collection
+func (m *model) closeCollection() tea.Cmd {
+	previous := m.collection
+	m.collection = nil
+	m.list.ResetFilter()
+	cmd := m.refreshItems()
+	for index, item := range m.list.Items() {
+		if c, ok := item.(*collection); ok && c.kind == previous.kind && c.name == previous.name {
+			m.list.Select(index)
+			break
+		}
+	}
+	if !m.loading && !m.refreshing {
+		m.list.Title = m.baseTitle()
+	}
+	return cmd
+}
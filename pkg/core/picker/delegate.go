@@ -1,21 +1,142 @@
 package picker
 
 import (
+	"fmt"
+	"io"
+	"time"
+
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/list"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/reflow/truncate"
 	"github.com/reubenmiller/c8y-session-bitwarden/pkg/core"
 )
 
-func newItemDelegate(keys *delegateKeyMap) list.DefaultDelegate {
+// itemDelegate renders sessions with a mode badge, as well as group headers
+type itemDelegate struct {
+	list.DefaultDelegate
+
+	// sessions contains the original sessions, e.g. to check if a session has a TOTP secret
+	sessions *sessionIndex
+
+	// prefs is used to mark pinned and hidden sessions (optional)
+	prefs Preferences
+
+	// marked contains the sessions marked in the multi-select mode (nil if not enabled)
+	marked *multiSelection
+}
+
+// checkbox returns the selection indicator of a session in the multi-select mode
+func (d itemDelegate) checkbox(s *core.CumulocitySession) string {
+	switch {
+	case d.marked == nil:
+		return ""
+	case d.marked.Contains(s.SessionURI):
+		return "[x]"
+	}
+	return "[ ]"
+}
+
+// marker returns the indicator of a pinned or hidden session
+func (d itemDelegate) marker(s *core.CumulocitySession) string {
+	switch {
+	case d.prefs == nil:
+		return ""
+	case d.prefs.IsPinned(s.SessionURI):
+		return "★"
+	case d.prefs.IsHidden(s.SessionURI):
+		return "⊘"
+	}
+	return ""
+}
+
+// Render prints a session or a group header
+func (d itemDelegate) Render(w io.Writer, m list.Model, index int, item list.Item) {
+	if m.Width() <= 0 {
+		return
+	}
+
+	var (
+		s           = &d.Styles
+		isSelected  = index == m.Index()
+		emptyFilter = m.FilterState() == list.Filtering && m.FilterValue() == ""
+	)
+
+	switch i := item.(type) {
+	case *groupHeader:
+		icon := "▼"
+		if i.collapsed {
+			icon = "▶"
+		}
+		style := groupHeaderStyle
+		if isSelected {
+			style = groupHeaderSelectedStyle
+		}
+		text := truncate.StringWithTail(fmt.Sprintf("%s %s (%d)", icon, i.name, i.count), uint(max(m.Width()-style.GetHorizontalFrameSize(), 0)), "…")
+		fmt.Fprintf(w, "%s\n", style.Render(text))
+
+	case *collection:
+		titleStyle, descStyle := s.NormalTitle, s.NormalDesc
+		if emptyFilter {
+			titleStyle, descStyle = s.DimmedTitle, s.DimmedDesc
+		} else if isSelected && m.FilterState() != list.Filtering {
+			titleStyle, descStyle = s.SelectedTitle, s.SelectedDesc
+		}
+		textwidth := uint(max(m.Width()-titleStyle.GetHorizontalFrameSize(), 0))
+		title := truncate.StringWithTail("▸ "+i.label(), textwidth, "…")
+		desc := truncate.StringWithTail(fmt.Sprintf("%d sessions", i.count), textwidth, "…")
+		fmt.Fprintf(w, "%s\n%s", titleStyle.Render(title), descStyle.Render(desc))
+
+	case *core.CumulocitySession:
+		titleStyle, descStyle := s.NormalTitle, s.NormalDesc
+		if emptyFilter {
+			titleStyle, descStyle = s.DimmedTitle, s.DimmedDesc
+		} else if isSelected && m.FilterState() != list.Filtering {
+			titleStyle, descStyle = s.SelectedTitle, s.SelectedDesc
+		}
+
+		badge := modeBadge(i.Mode)
+		if checkbox := d.checkbox(i); checkbox != "" {
+			badge = checkbox + " " + badge
+		}
+		if marker := d.marker(i); marker != "" {
+			badge += " " + marker
+		}
+
+		// Show the current code of the highlighted session, and only an indicator for the others
+		var totp string
+		if original := d.sessions.Get(i.SessionURI); original != nil && original.TOTPSecret != "" {
+			totp = " " + totpStyle.Render(totpIndicator)
+			if isSelected && m.FilterState() != list.Filtering {
+				totp = " " + totpBadge(original.TOTPSecret, time.Now())
+			}
+		}
+
+		// Prevent text from exceeding list width
+		textwidth := m.Width() - titleStyle.GetPaddingLeft() - titleStyle.GetPaddingRight()
+		title := truncate.StringWithTail(i.Title(), uint(max(textwidth-lipgloss.Width(badge)-1-lipgloss.Width(totp), 0)), "…")
+		desc := truncate.StringWithTail(i.Description(), uint(max(textwidth, 0)), "…")
+
+		// Style the parts individually so that the badge keeps its own colours
+		title = titleStyle.Render(badge + " " + titleStyle.Copy().Inline(true).Render(title) + totp)
+		fmt.Fprintf(w, "%s\n%s", title, descStyle.Render(desc))
+	}
+}
+
+func newItemDelegate(keys *delegateKeyMap, sessions *sessionIndex, prefs Preferences, marked *multiSelection) itemDelegate {
 	d := list.NewDefaultDelegate()
+	d.Styles = itemStyles
 
 	d.UpdateFunc = func(msg tea.Msg, m *list.Model) tea.Cmd {
 		var title string
+		var session *core.CumulocitySession
 
 		if i, ok := m.SelectedItem().(*core.CumulocitySession); ok {
 			title = i.Host
-		} else {
+			session = sessions.Get(i.SessionURI)
+		}
+		if session == nil {
 			return nil
 		}
 
@@ -25,15 +146,30 @@ func newItemDelegate(keys *delegateKeyMap) list.DefaultDelegate {
 			case key.Matches(msg, keys.choose):
 				return m.NewStatusMessage(statusMessageStyle("You chose " + title))
 
-			case key.Matches(msg, keys.remove):
-				index := m.Index()
-				m.RemoveItem(index)
-				if len(m.Items()) == 0 {
-					keys.remove.SetEnabled(false)
+			case key.Matches(msg, keys.copyUsername):
+				return copyToClipboard("username", session.Username, false)
+
+			case key.Matches(msg, keys.copyPassword):
+				return copyToClipboard("password", session.Password, true)
+
+			case key.Matches(msg, keys.copyTOTP):
+				if session.TOTPSecret == "" {
+					return m.NewStatusMessage(statusErrorStyle("No TOTP secret set"))
 				}
-				return m.NewStatusMessage(statusMessageStyle("Deleted " + title))
-			case key.Matches(msg, keys.cancel):
-				return tea.Quit
+				code, err := core.GetTOTPCodeFromSecret(session.TOTPSecret)
+				if err != nil {
+					return m.NewStatusMessage(statusErrorStyle("Could not generate TOTP code. " + err.Error()))
+				}
+				return copyToClipboard("TOTP code", code, true)
+
+			case key.Matches(msg, keys.revealPassword):
+				if session.Password == "" {
+					return m.NewStatusMessage(statusErrorStyle("No password set"))
+				}
+				return m.NewStatusMessage(statusMessageStyle("Password: " + session.Password))
+
+			case key.Matches(msg, keys.openBrowser):
+				return openBrowser(TenantURL(session.Host))
 			}
 
 		}
@@ -41,7 +177,7 @@ func newItemDelegate(keys *delegateKeyMap) list.DefaultDelegate {
 		return nil
 	}
 
-	help := []key.Binding{keys.choose, keys.remove}
+	help := []key.Binding{keys.choose, keys.copyUsername, keys.copyPassword, keys.copyTOTP, keys.revealPassword, keys.openBrowser}
 
 	d.ShortHelpFunc = func() []key.Binding {
 		return help
@@ -51,13 +187,17 @@ func newItemDelegate(keys *delegateKeyMap) list.DefaultDelegate {
 		return [][]key.Binding{help}
 	}
 
-	return d
+	return itemDelegate{DefaultDelegate: d, sessions: sessions, prefs: prefs, marked: marked}
 }
 
 type delegateKeyMap struct {
-	choose key.Binding
-	remove key.Binding
-	cancel key.Binding
+	choose         key.Binding
+	copyUsername   key.Binding
+	copyPassword   key.Binding
+	copyTOTP       key.Binding
+	revealPassword key.Binding
+	openBrowser    key.Binding
+	cancel         key.Binding
 }
 
 // Additional short help entries. This satisfies the help.KeyMap interface and
@@ -65,7 +205,7 @@ type delegateKeyMap struct {
 func (d delegateKeyMap) ShortHelp() []key.Binding {
 	return []key.Binding{
 		d.choose,
-		d.remove,
+		d.copyPassword,
 		d.cancel,
 	}
 }
@@ -76,25 +216,24 @@ func (d delegateKeyMap) FullHelp() [][]key.Binding {
 	return [][]key.Binding{
 		{
 			d.choose,
-			d.remove,
+			d.copyUsername,
+			d.copyPassword,
+			d.copyTOTP,
+			d.revealPassword,
+			d.openBrowser,
 			d.cancel,
 		},
 	}
 }
 
-func newDelegateKeyMap() *delegateKeyMap {
+func newDelegateKeyMap(k KeyBindings) *delegateKeyMap {
 	return &delegateKeyMap{
-		choose: key.NewBinding(
-			key.WithKeys("enter"),
-			key.WithHelp("enter", "choose"),
-		),
-		remove: key.NewBinding(
-			key.WithKeys("x", "backspace"),
-			key.WithHelp("x", "delete"),
-		),
-		cancel: key.NewBinding(
-			key.WithKeys("esc", "ctrl+c", "c"),
-			key.WithHelp("esc/ctrl+c/c", "cancel"),
-		),
+		choose:         k.binding(ActionChoose),
+		copyUsername:   k.binding(ActionCopyUsername),
+		copyPassword:   k.binding(ActionCopyPassword),
+		copyTOTP:       k.binding(ActionCopyTOTP),
+		revealPassword: k.binding(ActionRevealPassword),
+		openBrowser:    k.binding(ActionOpenBrowser),
+		cancel:         k.binding(ActionCancel),
 	}
 }
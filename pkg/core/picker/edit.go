@@ -0,0 +1,185 @@
+package picker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/reubenmiller/c8y-session-bitwarden/pkg/core"
+)
+
+// SaveFunc writes the edited metadata of a session back to the vault, and returns the updated session
+type SaveFunc func(ctx context.Context, s *core.CumulocitySession, edit *core.SessionEdit) (*core.CumulocitySession, error)
+
+type editKeyMap struct {
+	next   key.Binding
+	prev   key.Binding
+	save   key.Binding
+	cancel key.Binding
+}
+
+func newEditKeyMap(k KeyBindings) *editKeyMap {
+	return &editKeyMap{
+		next:   k.binding(ActionNextField),
+		prev:   k.binding(ActionPrevField),
+		save:   k.binding(ActionSave),
+		cancel: k.binding(ActionCancelEdit),
+	}
+}
+
+// formField is an input of the edit form
+type formField struct {
+	label string
+	input textinput.Model
+
+	// set applies the value of the input to the edit
+	set func(edit *core.SessionEdit, value string)
+}
+
+// editSavedMsg is sent once the edited session has been saved (or failed to be saved)
+type editSavedMsg struct {
+	uri     string
+	session *core.CumulocitySession
+	err     error
+}
+
+// editForm edits the name, uris and custom fields of a session
+type editForm struct {
+	session *core.CumulocitySession
+	fields  []formField
+	focus   int
+	keys    *editKeyMap
+	saving  bool
+	err     error
+}
+
+func newEditForm(s *core.CumulocitySession, keys *editKeyMap) *editForm {
+	edit := core.NewSessionEdit(s)
+	newField := func(label, value, placeholder string, set func(edit *core.SessionEdit, value string)) formField {
+		input := textinput.New()
+		input.Prompt = ""
+		input.Placeholder = placeholder
+		input.SetValue(value)
+		return formField{label: label, input: input, set: set}
+	}
+	setField := func(name string) func(edit *core.SessionEdit, value string) {
+		return func(edit *core.SessionEdit, value string) {
+			edit.Fields[name] = value
+		}
+	}
+
+	form := &editForm{
+		session: s,
+		keys:    keys,
+		fields: []formField{
+			newField("Name", edit.Name, "", func(edit *core.SessionEdit, value string) {
+				edit.Name = value
+			}),
+			newField("URIs", strings.Join(edit.URIs, ", "), "comma separated", func(edit *core.SessionEdit, value string) {
+				edit.URIs = strings.Split(value, ",")
+			}),
+			newField("Tenant", edit.Fields[core.FieldTenant], "e.g. t12345", setField(core.FieldTenant)),
+			newField("Mode", edit.Fields[core.FieldMode], strings.Join([]string{core.TypeDev, core.TypeQual, core.TypeProduction}, ", "), setField(core.FieldMode)),
+			newField("Login type", edit.Fields[core.FieldLoginType], strings.Join(core.LoginTypes, ", "), setField(core.FieldLoginType)),
+		},
+	}
+	form.fields[0].input.Focus()
+	return form
+}
+
+// edit returns the metadata of the form
+func (f *editForm) edit() *core.SessionEdit {
+	edit := core.NewSessionEdit(f.session)
+	for _, field := range f.fields {
+		field.set(edit, field.input.Value())
+	}
+	edit.RemoveUnchangedFields(f.session)
+	return edit
+}
+
+// setFocus moves the focus to the field with the given index
+func (f *editForm) setFocus(index int) tea.Cmd {
+	f.fields[f.focus].input.Blur()
+	f.focus = (index + len(f.fields)) % len(f.fields)
+	return f.fields[f.focus].input.Focus()
+}
+
+// save validates the form and saves the session in the background
+func (f *editForm) save(ctx context.Context, saveFunc SaveFunc) tea.Cmd {
+	edit := f.edit()
+	if err := edit.Validate(); err != nil {
+		f.err = err
+		return nil
+	}
+	f.err = nil
+	f.saving = true
+	original := f.session
+	return func() tea.Msg {
+		s, err := saveFunc(ctx, original, edit)
+		return editSavedMsg{uri: original.SessionURI, session: s, err: err}
+	}
+}
+
+// Update handles the key presses of the form. The bool is true if the form should be closed
+func (f *editForm) Update(ctx context.Context, msg tea.Msg, saveFunc SaveFunc) (tea.Cmd, bool) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		if f.saving {
+			// Ignore any input whilst saving
+			return nil, false
+		}
+		switch {
+		case key.Matches(msg, f.keys.cancel):
+			return nil, true
+		case key.Matches(msg, f.keys.save):
+			return f.save(ctx, saveFunc), false
+		case msg.Type == tea.KeyEnter && f.focus == len(f.fields)-1 && key.Matches(msg, f.keys.next):
+			// enter moves to the next field, or saves the form on the last field
+			return f.save(ctx, saveFunc), false
+		case key.Matches(msg, f.keys.next):
+			return f.setFocus(f.focus + 1), false
+		case key.Matches(msg, f.keys.prev):
+			return f.setFocus(f.focus - 1), false
+		}
+	}
+
+	var cmd tea.Cmd
+	f.fields[f.focus].input, cmd = f.fields[f.focus].input.Update(msg)
+	return cmd, false
+}
+
+// View renders the form with the given width
+func (f *editForm) View(width int) string {
+	lines := []string{
+		titleStyle.Render("Edit session"),
+		"",
+	}
+	for i, field := range f.fields {
+		label := formLabelStyle.Render(field.label)
+		if i == f.focus {
+			label = formLabelFocusedStyle.Render(field.label)
+		}
+		field.input.Width = max(width-lipgloss.Width(label)-2, 10)
+		lines = append(lines, label+" "+field.input.View())
+	}
+	lines = append(lines, "")
+
+	switch {
+	case f.saving:
+		lines = append(lines, statusMessageStyle("Saving…"))
+	case f.err != nil:
+		lines = append(lines, statusErrorStyle(fmt.Sprintf("✘ %s", f.err)))
+	default:
+		lines = append(lines, "")
+	}
+
+	help := []string{}
+	for _, binding := range []key.Binding{f.keys.next, f.keys.prev, f.keys.save, f.keys.cancel} {
+		help = append(help, binding.Help().Key+" "+binding.Help().Desc)
+	}
+	lines = append(lines, "", formHelpStyle.Render(strings.Join(help, " • ")))
+	return strings.Join(lines, "\n")
+}
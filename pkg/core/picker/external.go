@@ -0,0 +1,370 @@
+package picker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/cli/safeexec"
+	"github.com/reubenmiller/c8y-session-bitwarden/pkg/core"
+)
+
+const (
+	BackendBuiltin = "builtin"
+	BackendFzf     = "fzf"
+	BackendGum     = "gum"
+	BackendPrompt  = "prompt"
+)
+
+// Backends lists the supported picker backends
+var Backends = []string{BackendBuiltin, BackendFzf, BackendGum, BackendPrompt}
+
+// ValidateBackend checks if the picker backend is supported
+func ValidateBackend(v string) error {
+	if v == "" || slices.Contains(Backends, v) {
+		return nil
+	}
+	return fmt.Errorf("invalid picker: %s. allowed values: %s", v, strings.Join(Backends, ", "))
+}
+
+// lineFields are the fields of the line format used to pass sessions to external pickers.
+// The order must not be changed, as the fields are referenced by index (e.g. in the fzf preview)
+var lineFields = []func(s *core.CumulocitySession) string{
+	func(s *core.CumulocitySession) string { return s.SessionURI },
+	func(s *core.CumulocitySession) string { return s.Host },
+	func(s *core.CumulocitySession) string { return s.Name },
+	func(s *core.CumulocitySession) string { return s.Tenant },
+	func(s *core.CumulocitySession) string { return s.Username },
+	func(s *core.CumulocitySession) string {
+		v, _ := core.MarshalSessionType(s.Mode)
+		return v
+	},
+	func(s *core.CumulocitySession) string { return s.FolderName },
+}
+
+// FormatLine returns the session in a stable, tab separated line format:
+//
+//	<sessionUri> <host> <name> <tenant> <username> <mode> <folder>
+func FormatLine(s *core.CumulocitySession) string {
+	values := make([]string, 0, len(lineFields))
+	for _, field := range lineFields {
+		// Tabs and newlines would break the format
+		values = append(values, strings.Map(func(r rune) rune {
+			if r == '\t' || r == '\n' || r == '\r' {
+				return ' '
+			}
+			return r
+		}, field(s)))
+	}
+	return strings.Join(values, "\t")
+}
+
+// sessionFromLine maps a line (in the FormatLine format) back to the session
+func sessionFromLine(line string, sessions []*core.CumulocitySession) (*core.CumulocitySession, error) {
+	uri, _, _ := strings.Cut(strings.TrimSpace(line), "\t")
+	for _, s := range sessions {
+		if s.SessionURI == uri {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("selected line does not match any session. line=%s", line)
+}
+
+// sessionsFromLines maps each non-empty line (in the FormatLine format) back to the session
+func sessionsFromLines(lines string, sessions []*core.CumulocitySession) ([]*core.CumulocitySession, error) {
+	selected := make([]*core.CumulocitySession, 0)
+	for _, line := range strings.Split(lines, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		s, err := sessionFromLine(line, sessions)
+		if err != nil {
+			return nil, err
+		}
+		selected = append(selected, s)
+	}
+	return selected, nil
+}
+
+func formatLines(sessions []*core.CumulocitySession) string {
+	lines := make([]string, 0, len(sessions))
+	for _, s := range sessions {
+		lines = append(lines, FormatLine(s))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// fzfPreview shows the fields of the line format, so no additional commands are required
+const fzfPreview = `printf 'Name:     %s\nHost:     %s\nTenant:   %s\nUsername: %s\nMode:     %s\nFolder:   %s\nURI:      %s\n' {3} {2} {4} {5} {6} {7} {1}`
+
+// runExternal runs an external picker which reads the sessions from stdin and writes the selected line(s) to stdout
+func runExternal(ctx context.Context, name string, args []string, sessions []*core.CumulocitySession) ([]*core.CumulocitySession, error) {
+	stdout := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = strings.NewReader(formatLines(sessions))
+	cmd.Stdout = stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("%w. %w", ErrCancelled, ctx.Err())
+		}
+		exitErr := &exec.ExitError{}
+		if errors.As(err, &exitErr) {
+			// fzf: 1 = no match, 130 = interrupted. gum: 130 = interrupted
+			switch exitErr.ExitCode() {
+			case 1, 130:
+				return nil, ErrCancelled
+			}
+		}
+		return nil, fmt.Errorf("failed to run %s. %w", name, err)
+	}
+
+	selected, err := sessionsFromLines(stdout.String(), sessions)
+	if err != nil {
+		return nil, err
+	}
+	if len(selected) == 0 {
+		return nil, ErrCancelled
+	}
+	return selected, nil
+}
+
+func pickFzf(ctx context.Context, sessions []*core.CumulocitySession, multi bool) ([]*core.CumulocitySession, error) {
+	args := []string{
+		"--delimiter", "\t",
+		"--with-nth", "2..",
+		"--prompt", "Session> ",
+		"--preview", fzfPreview,
+		"--preview-window", "right:40%:wrap",
+	}
+	if multi {
+		args = append(args, "--multi")
+	}
+	return runExternal(ctx, "fzf", args, sessions)
+}
+
+func pickGum(ctx context.Context, sessions []*core.CumulocitySession, multi bool) ([]*core.CumulocitySession, error) {
+	args := []string{
+		"filter",
+		"--placeholder", "Search sessions...",
+	}
+	if multi {
+		args = append(args, "--no-limit")
+	}
+	return runExternal(ctx, "gum", args, sessions)
+}
+
+// parseNumbers parses a list of numbers and ranges, e.g. "1,3 5-7". Each number must be between 1 and max
+func parseNumbers(v string, max int) ([]int, error) {
+	numbers := make([]int, 0)
+	for _, part := range strings.FieldsFunc(v, func(r rune) bool {
+		return r == ',' || r == ' '
+	}) {
+		from, to, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(from)
+		if err != nil {
+			return nil, err
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(to); err != nil {
+				return nil, err
+			}
+		}
+		if start < 1 || end > max || start > end {
+			return nil, fmt.Errorf("out of range: %s", part)
+		}
+		for n := start; n <= end; n++ {
+			if !slices.Contains(numbers, n) {
+				numbers = append(numbers, n)
+			}
+		}
+	}
+	if len(numbers) == 0 {
+		return nil, fmt.Errorf("no number given")
+	}
+	return numbers, nil
+}
+
+// filterSessions returns the sessions matching the text, sorted by their relevance. The text is parsed
+// using the query language, or is matched as plain text if it is not a valid query
+func filterSessions(sessions []*core.CumulocitySession, text string) []*core.CumulocitySession {
+	matches := make([]*core.CumulocitySession, 0)
+	query, err := core.ParseQuery(text)
+	if err != nil {
+		for _, s := range sessions {
+			if core.MatchSession(s, text) {
+				matches = append(matches, s)
+			}
+		}
+		return matches
+	}
+	for _, ranked := range core.RankSessions(query, sessions) {
+		matches = append(matches, ranked.Session)
+	}
+	return matches
+}
+
+// numberSelection returns the numbers of the answer if it only contains numbers and ranges which are
+// between 1 and max, e.g. "1,3 5-7". Other answers (e.g. an item id prefix such as 2222) are used as a filter
+func numberSelection(v string, max int) ([]int, bool) {
+	if strings.Trim(v, "0123456789,- ") != "" {
+		return nil, false
+	}
+	numbers, err := parseNumbers(v, max)
+	return numbers, err == nil
+}
+
+// pickPrompt shows a numbered list of the sessions and reads either the number of the selected session,
+// or text to filter the list. This is repeated until a single session is chosen, e.g. a filter which only
+// matches one session selects it. In the multi-select mode, several numbers and ranges can be given,
+// e.g. "1,3 5-7". Only plain lines are written, so it can be used with screen readers and dumb terminals
+func pickPrompt(ctx context.Context, sessions []*core.CumulocitySession, input io.Reader, output io.Writer, multi bool) ([]*core.CumulocitySession, error) {
+	shown := sessions
+	printSessions := func() {
+		for i, s := range shown {
+			fmt.Fprintf(output, "%3d) %s\n     %s\n", i+1, s.Title(), s.Description())
+		}
+	}
+	printSelected := func(selected []*core.CumulocitySession) {
+		for _, s := range selected {
+			fmt.Fprintf(output, "Selected %s (%s)\n", s.Title(), s.Description())
+		}
+	}
+	printSessions()
+
+	scanner := bufio.NewScanner(input)
+	for {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("%w. %w", ErrCancelled, ctx.Err())
+		}
+		if multi {
+			fmt.Fprintf(output, "Select sessions [1-%d], e.g. 1,3 5-7, or type text to filter (q to cancel): ", len(shown))
+		} else {
+			fmt.Fprintf(output, "Select a session [1-%d], or type text to filter (q to cancel): ", len(shown))
+		}
+		if !scanner.Scan() {
+			fmt.Fprintln(output)
+			return nil, ErrCancelled
+		}
+		answer := strings.TrimSpace(scanner.Text())
+		numbers, isSelection := numberSelection(answer, len(shown))
+		switch {
+		case answer == "q":
+			return nil, ErrCancelled
+
+		case answer == "":
+			if len(shown) == len(sessions) {
+				return nil, ErrCancelled
+			}
+			// Show all of the sessions again
+			shown = sessions
+			printSessions()
+
+		case isSelection:
+			if !multi && len(numbers) > 1 {
+				fmt.Fprintf(output, "Invalid selection: %s\n", answer)
+				continue
+			}
+			selected := make([]*core.CumulocitySession, 0, len(numbers))
+			for _, n := range numbers {
+				selected = append(selected, shown[n-1])
+			}
+			printSelected(selected)
+			return selected, nil
+
+		default:
+			matches := filterSessions(shown, answer)
+			switch {
+			case len(matches) == 0:
+				fmt.Fprintf(output, "No sessions match: %s (press enter to show all sessions)\n", answer)
+			case len(matches) == 1 && !multi:
+				printSelected(matches)
+				return matches, nil
+			default:
+				shown = matches
+				fmt.Fprintf(output, "%d of %d sessions match: %s\n", len(shown), len(sessions), answer)
+				printSessions()
+			}
+		}
+	}
+}
+
+// openTTY opens the terminal for reading, so that the prompt can be answered when stdin is redirected
+func openTTY() (*os.File, error) {
+	if runtime.GOOS == "windows" {
+		return os.Open("CONIN$")
+	}
+	return os.Open("/dev/tty")
+}
+
+// hasCursorAddressing returns false if the terminal can not move the cursor (e.g. TERM=dumb), which is
+// required to draw the builtin picker
+func hasCursorAddressing() bool {
+	term := os.Getenv("TERM")
+	if runtime.GOOS == "windows" {
+		// TERM is usually not set on Windows
+		return term != "dumb"
+	}
+	return term != "" && term != "dumb"
+}
+
+// isBuiltin returns true if the builtin picker is used for the backend, e.g. when the external
+// tool is not installed
+func isBuiltin(backend string) bool {
+	switch backend {
+	case BackendFzf, BackendGum:
+		_, err := safeexec.LookPath(backend)
+		return err != nil
+	case BackendPrompt:
+		return false
+	}
+	return true
+}
+
+// pickWithBackend selects a session using a non-builtin backend. The bool is false if the
+// builtin picker should be used instead, e.g. when the external tool is not installed
+func pickWithBackend(ctx context.Context, sessions []*core.CumulocitySession, options PickerOptions) ([]*core.CumulocitySession, bool, error) {
+	switch options.Backend {
+	case BackendFzf, BackendGum:
+		if _, err := safeexec.LookPath(options.Backend); err != nil {
+			slog.Warn("Picker is not installed, so using the builtin picker instead.", "picker", options.Backend)
+			return nil, false, nil
+		}
+		var selected []*core.CumulocitySession
+		var err error
+		if options.Backend == BackendFzf {
+			selected, err = pickFzf(ctx, sessions, options.Multi)
+		} else {
+			selected, err = pickGum(ctx, sessions, options.Multi)
+		}
+		return selected, true, err
+
+	case BackendPrompt:
+		input, output := options.Input, options.Output
+		if input == nil {
+			input = os.Stdin
+			if tty, err := openTTY(); err == nil {
+				defer tty.Close()
+				input = tty
+			}
+		}
+		if output == nil {
+			output = os.Stderr
+		}
+		selected, err := pickPrompt(ctx, sessions, input, output, options.Multi)
+		return selected, true, err
+	}
+	return nil, false, nil
+}
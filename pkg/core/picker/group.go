@@ -0,0 +1,122 @@
+package picker
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/reubenmiller/c8y-session-bitwarden/pkg/core"
+)
+
+const (
+	GroupByNone         = ""
+	GroupByFolder       = "folder"
+	GroupByMode         = "mode"
+	GroupByTenant       = "tenant"
+	GroupByDomain       = "domain"
+	GroupByOrganization = "organization"
+)
+
+// GroupByOptions lists the supported values which sessions can be grouped by
+var GroupByOptions = []string{
+	GroupByFolder,
+	GroupByMode,
+	GroupByTenant,
+	GroupByDomain,
+	GroupByOrganization,
+}
+
+// groupHeader is a list item which is used as the section header of a group of sessions
+type groupHeader struct {
+	name      string
+	count     int
+	collapsed bool
+}
+
+// FilterValue is empty so that headers are not shown when filtering
+func (h *groupHeader) FilterValue() string { return "" }
+
+// HostDomain returns the domain of the host without the first (tenant specific) label,
+// e.g. "https://t12345.eu-latest.cumulocity.com" returns "eu-latest.cumulocity.com"
+func HostDomain(host string) string {
+	hostname := host
+	if u, err := url.Parse(TenantURL(host)); err == nil && u.Hostname() != "" {
+		hostname = u.Hostname()
+	}
+	labels := strings.Split(hostname, ".")
+	if len(labels) > 2 {
+		return strings.Join(labels[1:], ".")
+	}
+	return hostname
+}
+
+// groupKey returns the name of the group the session belongs to
+func groupKey(s *core.CumulocitySession, groupBy string) string {
+	var v, fallback string
+	switch groupBy {
+	case GroupByFolder:
+		v, fallback = s.FolderName, "No folder"
+	case GroupByMode:
+		v, _ = core.MarshalSessionType(s.Mode)
+	case GroupByTenant:
+		v, fallback = s.Tenant, "No tenant"
+	case GroupByDomain:
+		v, fallback = HostDomain(s.Host), "No host"
+	case GroupByOrganization:
+		v, fallback = s.OrganizationName, "My vault"
+	}
+	if v == "" {
+		return fallback
+	}
+	return v
+}
+
+// ValidateGroupBy checks if the value can be used to group sessions
+func ValidateGroupBy(v string) error {
+	if v == GroupByNone || slices.Contains(GroupByOptions, v) {
+		return nil
+	}
+	return fmt.Errorf("invalid group by value: %s. allowed values: %s", v, strings.Join(GroupByOptions, ", "))
+}
+
+// groupItems returns the list items of the sessions sorted into groups (preserving the order
+// within each group). Each group starts with a header item, and the sessions of collapsed groups are omitted
+func groupItems(sessions []*core.CumulocitySession, groupBy string, collapsed map[string]bool) []list.Item {
+	items := make([]list.Item, 0, len(sessions))
+	if groupBy == GroupByNone {
+		for _, s := range sessions {
+			items = append(items, core.CloneSession(s))
+		}
+		return items
+	}
+
+	names := make([]string, 0)
+	groups := make(map[string][]*core.CumulocitySession)
+	for _, s := range sessions {
+		name := groupKey(s, groupBy)
+		if _, found := groups[name]; !found {
+			names = append(names, name)
+		}
+		groups[name] = append(groups[name], s)
+	}
+	slices.SortStableFunc(names, func(a, b string) int {
+		return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+	})
+
+	for _, name := range names {
+		items = append(items, &groupHeader{
+			name:      name,
+			count:     len(groups[name]),
+			collapsed: collapsed[name],
+		})
+		if collapsed[name] {
+			continue
+		}
+		for _, s := range groups[name] {
+			items = append(items, core.CloneSession(s))
+		}
+	}
+	return items
+}
@@ -0,0 +1,310 @@
+package picker
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+)
+
+const (
+	KeyMapDefault = "default"
+	KeyMapVim     = "vim"
+	KeyMapEmacs   = "emacs"
+)
+
+// KeyMaps lists the supported key binding presets
+var KeyMaps = []string{
+	KeyMapDefault,
+	KeyMapVim,
+	KeyMapEmacs,
+}
+
+// Actions of the picker which can be bound to keys
+const (
+	ActionChoose           = "choose"
+	ActionCancel           = "cancel"
+	ActionUp               = "up"
+	ActionDown             = "down"
+	ActionNextPage         = "nextPage"
+	ActionPrevPage         = "prevPage"
+	ActionGoToStart        = "goToStart"
+	ActionGoToEnd          = "goToEnd"
+	ActionFilter           = "filter"
+	ActionClearFilter      = "clearFilter"
+	ActionHelp             = "help"
+	ActionCopyUsername     = "copyUsername"
+	ActionCopyPassword     = "copyPassword"
+	ActionCopyTOTP         = "copyTOTP"
+	ActionRevealPassword   = "revealPassword"
+	ActionOpenBrowser      = "openBrowser"
+	ActionEdit             = "edit"
+	ActionRefresh          = "refresh"
+	ActionHide             = "hide"
+	ActionPin              = "pin"
+	ActionMark             = "mark"
+	ActionBack             = "back"
+	ActionSortColumn       = "sortColumn"
+	ActionSortReverse      = "sortReverse"
+	ActionToggleTitle      = "toggleTitle"
+	ActionToggleStatus     = "toggleStatus"
+	ActionTogglePagination = "togglePagination"
+	ActionToggleHelp       = "toggleHelp"
+	ActionTogglePreview    = "togglePreview"
+	ActionToggleGroup      = "toggleGroup"
+
+	// Actions of the edit form
+	ActionNextField  = "nextField"
+	ActionPrevField  = "prevField"
+	ActionSave       = "save"
+	ActionCancelEdit = "cancelEdit"
+)
+
+// formActions are only active whilst the edit form is open (instead of the list), so their keys
+// only need to be unique within the form, e.g. esc is used for both cancel and cancelEdit
+var formActions = []string{
+	ActionNextField,
+	ActionPrevField,
+	ActionSave,
+	ActionCancelEdit,
+}
+
+// forceQuitKey always cancels the picker, so it can not be bound to any other action
+const forceQuitKey = "ctrl+c"
+
+// actionHelp contains the help text of each action
+var actionHelp = map[string]string{
+	ActionChoose:           "choose",
+	ActionCancel:           "cancel",
+	ActionUp:               "up",
+	ActionDown:             "down",
+	ActionNextPage:         "next page",
+	ActionPrevPage:         "prev page",
+	ActionGoToStart:        "go to start",
+	ActionGoToEnd:          "go to end",
+	ActionFilter:           "filter",
+	ActionClearFilter:      "clear filter",
+	ActionHelp:             "more",
+	ActionCopyUsername:     "copy username",
+	ActionCopyPassword:     "copy password",
+	ActionCopyTOTP:         "copy totp",
+	ActionRevealPassword:   "reveal password",
+	ActionOpenBrowser:      "open in browser",
+	ActionEdit:             "edit session",
+	ActionRefresh:          "sync and refresh",
+	ActionHide:             "hide/unhide session",
+	ActionPin:              "pin/unpin session",
+	ActionMark:             "toggle selection",
+	ActionBack:             "back to folders",
+	ActionSortColumn:       "sort by next column",
+	ActionSortReverse:      "reverse sort order",
+	ActionToggleTitle:      "toggle title",
+	ActionToggleStatus:     "toggle status",
+	ActionTogglePagination: "toggle pagination",
+	ActionToggleHelp:       "toggle help",
+	ActionTogglePreview:    "toggle preview",
+	ActionToggleGroup:      "collapse/expand group",
+	ActionNextField:        "next field",
+	ActionPrevField:        "previous field",
+	ActionSave:             "save",
+	ActionCancelEdit:       "cancel",
+}
+
+// sharedKeys are the actions which may use the same keys, as they are never active at the same time.
+// An applied filter is cleared before the picker is cancelled
+var sharedKeys = map[string]string{
+	ActionClearFilter: ActionCancel,
+	ActionCancel:      ActionClearFilter,
+}
+
+// Actions returns the names of the actions which can be bound in the config file
+func Actions() []string {
+	actions := make([]string, 0, len(actionHelp))
+	for action := range actionHelp {
+		actions = append(actions, action)
+	}
+	slices.Sort(actions)
+	return actions
+}
+
+// KeyBindings maps the actions of the picker to their keys, e.g. {"cancel": ["esc", "ctrl+c"]}
+type KeyBindings map[string][]string
+
+func defaultKeyBindings() KeyBindings {
+	return KeyBindings{
+		ActionChoose:           {"enter"},
+		ActionCancel:           {"esc", "ctrl+c"},
+		ActionUp:               {"up", "k"},
+		ActionDown:             {"down", "j"},
+		ActionNextPage:         {"right", "l", "pgdown", "f", "d"},
+		ActionPrevPage:         {"left", "h", "pgup", "b", "u"},
+		ActionGoToStart:        {"home", "g"},
+		ActionGoToEnd:          {"end", "G"},
+		ActionFilter:           {"/"},
+		ActionClearFilter:      {"esc"},
+		ActionHelp:             {"?"},
+		ActionCopyUsername:     {"y"},
+		ActionCopyPassword:     {"p"},
+		ActionCopyTOTP:         {"t"},
+		ActionRevealPassword:   {"r"},
+		ActionOpenBrowser:      {"o"},
+		ActionEdit:             {"e"},
+		ActionRefresh:          {"ctrl+r"},
+		ActionHide:             {"x"},
+		ActionPin:              {"*"},
+		ActionMark:             {" "},
+		ActionBack:             {"backspace"},
+		ActionSortColumn:       {"s"},
+		ActionSortReverse:      {"R"},
+		ActionToggleTitle:      {"T"},
+		ActionToggleStatus:     {"S"},
+		ActionTogglePagination: {"P"},
+		ActionToggleHelp:       {"H"},
+		ActionTogglePreview:    {"v"},
+		ActionToggleGroup:      {"z"},
+		ActionNextField:        {"tab", "down", "enter"},
+		ActionPrevField:        {"shift+tab", "up"},
+		ActionSave:             {"ctrl+s"},
+		ActionCancelEdit:       {"esc"},
+	}
+}
+
+// keyMapPresets contains the changes of each preset compared to the default key bindings
+var keyMapPresets = map[string]KeyBindings{
+	KeyMapDefault: {},
+	KeyMapVim: {
+		ActionCancel:    {"q", "esc", "ctrl+c"},
+		ActionNextPage:  {"ctrl+f", "ctrl+d", "pgdown", "l", "right"},
+		ActionPrevPage:  {"ctrl+b", "ctrl+u", "pgup", "h", "left"},
+		ActionGoToStart: {"g", "home"},
+		ActionGoToEnd:   {"G", "end"},
+	},
+	KeyMapEmacs: {
+		ActionCancel:      {"ctrl+g", "esc", "ctrl+c"},
+		ActionUp:          {"ctrl+p", "up"},
+		ActionDown:        {"ctrl+n", "down"},
+		ActionNextPage:    {"ctrl+v", "pgdown"},
+		ActionPrevPage:    {"alt+v", "pgup"},
+		ActionGoToStart:   {"alt+<", "home"},
+		ActionGoToEnd:     {"alt+>", "end"},
+		ActionFilter:      {"ctrl+s", "/"},
+		ActionClearFilter: {"ctrl+g", "esc"},
+		ActionNextField:   {"tab", "ctrl+n", "down", "enter"},
+		ActionPrevField:   {"shift+tab", "ctrl+p", "up"},
+		ActionCancelEdit:  {"ctrl+g", "esc"},
+	},
+}
+
+// NewKeyBindings returns the key bindings of the given preset (or the default key bindings if the
+// name is empty), along with any overrides. An error is returned if a key is bound to several actions
+func NewKeyBindings(name string, overrides map[string][]string) (KeyBindings, error) {
+	if name == "" {
+		name = KeyMapDefault
+	}
+	preset, ok := keyMapPresets[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown key map: %s. allowed values: %s", name, strings.Join(KeyMaps, ", "))
+	}
+	bindings := defaultKeyBindings()
+	maps.Copy(bindings, preset)
+
+	for action, keys := range overrides {
+		if _, ok := actionHelp[action]; !ok {
+			return nil, fmt.Errorf("unknown key binding action: %s. allowed values: %s", action, strings.Join(Actions(), ", "))
+		}
+		if len(keys) == 0 {
+			return nil, fmt.Errorf("no keys are bound to %s", action)
+		}
+		bindings[action] = make([]string, 0, len(keys))
+		for _, v := range keys {
+			if v == "space" {
+				// The space key is reported as " "
+				v = " "
+			}
+			bindings[action] = append(bindings[action], v)
+		}
+	}
+
+	if err := bindings.validate(); err != nil {
+		return nil, err
+	}
+	return bindings, nil
+}
+
+// validate checks that each key is only bound to a single action. The actions of the list and
+// the edit form are checked separately, as they are never active at the same time
+func (k KeyBindings) validate() error {
+	listActions := slices.DeleteFunc(Actions(), func(action string) bool {
+		return slices.Contains(formActions, action)
+	})
+	for _, actions := range [][]string{listActions, formActions} {
+		used := map[string]string{
+			forceQuitKey: ActionCancel,
+		}
+		for _, action := range actions {
+			for _, v := range k[action] {
+				other, exists := used[v]
+				if exists && other != action && sharedKeys[action] != other {
+					return fmt.Errorf("key conflict: %s is bound to both %s and %s", helpKey(v), other, action)
+				}
+				if !exists {
+					used[v] = action
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// helpKey returns the name of the key shown in the help
+func helpKey(v string) string {
+	switch v {
+	case " ":
+		return "space"
+	case "up":
+		return "↑"
+	case "down":
+		return "↓"
+	case "left":
+		return "←"
+	case "right":
+		return "→"
+	}
+	return v
+}
+
+// binding returns the key binding of the action. At most three keys are shown in the help
+func (k KeyBindings) binding(action string) key.Binding {
+	keys := k[action]
+	names := make([]string, 0, len(keys))
+	for _, v := range keys[:min(len(keys), 3)] {
+		names = append(names, helpKey(v))
+	}
+	return key.NewBinding(
+		key.WithKeys(keys...),
+		key.WithHelp(strings.Join(names, "/"), actionHelp[action]),
+	)
+}
+
+// listKeyMap returns the key bindings used by the list for the navigation and the filter
+func (k KeyBindings) listKeyMap() list.KeyMap {
+	keyMap := list.DefaultKeyMap()
+	keyMap.CursorUp = k.binding(ActionUp)
+	keyMap.CursorDown = k.binding(ActionDown)
+	keyMap.NextPage = k.binding(ActionNextPage)
+	keyMap.PrevPage = k.binding(ActionPrevPage)
+	keyMap.GoToStart = k.binding(ActionGoToStart)
+	keyMap.GoToEnd = k.binding(ActionGoToEnd)
+	keyMap.Filter = k.binding(ActionFilter)
+	keyMap.ClearFilter = k.binding(ActionClearFilter)
+	keyMap.CancelWhileFiltering = k.binding(ActionClearFilter)
+	keyMap.CancelWhileFiltering.SetHelp(keyMap.CancelWhileFiltering.Help().Key, "cancel")
+	keyMap.ShowFullHelp = k.binding(ActionHelp)
+	keyMap.CloseFullHelp = k.binding(ActionHelp)
+	keyMap.CloseFullHelp.SetHelp(keyMap.CloseFullHelp.Help().Key, "close help")
+	keyMap.Quit = k.binding(ActionCancel)
+	return keyMap
+}
@@ -0,0 +1,100 @@
+package picker
+
+import (
+	"context"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/reubenmiller/c8y-session-bitwarden/pkg/core"
+)
+
+// Loader loads the sessions whilst the picker is already shown. The progress function can be called
+// with a short description of the current step, and the stream function with the sessions
+// which have been loaded so far (in batches). The returned sessions replace the streamed ones,
+// so they can be sorted differently
+type Loader func(ctx context.Context, progress func(status string), stream func(sessions []*core.CumulocitySession)) ([]*core.CumulocitySession, error)
+
+type loadProgressMsg struct {
+	status string
+}
+
+type loadBatchMsg struct {
+	sessions []*core.CumulocitySession
+}
+
+type loadDoneMsg struct {
+	sessions []*core.CumulocitySession
+	err      error
+}
+
+// startLoad runs the loader in the background. The progress of the loader is sent to the returned
+// channel, which is closed once the loader is done
+func startLoad(ctx context.Context, loader Loader) <-chan tea.Msg {
+	ch := make(chan tea.Msg)
+	send := func(msg tea.Msg) {
+		select {
+		case ch <- msg:
+		case <-ctx.Done():
+		}
+	}
+	go func() {
+		defer close(ch)
+		sessions, err := loader(ctx, func(status string) {
+			send(loadProgressMsg{status: status})
+		}, func(sessions []*core.CumulocitySession) {
+			send(loadBatchMsg{sessions: sessions})
+		})
+		send(loadDoneMsg{sessions: sessions, err: err})
+	}()
+	return ch
+}
+
+// waitForLoad waits for the next message of the loader
+func waitForLoad(ch <-chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		msg, ok := <-ch
+		if !ok {
+			return nil
+		}
+		return msg
+	}
+}
+
+// sessionIndex contains the original sessions (including secrets) by SessionURI. It is safe for
+// concurrent use, as the list filter runs in the background whilst sessions can still be added
+type sessionIndex struct {
+	mu       sync.RWMutex
+	sessions map[string]*core.CumulocitySession
+}
+
+func newSessionIndex(sessions []*core.CumulocitySession) *sessionIndex {
+	index := &sessionIndex{
+		sessions: make(map[string]*core.CumulocitySession, len(sessions)),
+	}
+	index.Add(sessions...)
+	return index
+}
+
+// Get returns the session with the given SessionURI, or nil if it does not exist
+func (i *sessionIndex) Get(uri string) *core.CumulocitySession {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.sessions[uri]
+}
+
+// Add adds (or replaces) the sessions
+func (i *sessionIndex) Add(sessions ...*core.CumulocitySession) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for _, s := range sessions {
+		i.sessions[s.SessionURI] = s
+	}
+}
+
+// Replace replaces all of the sessions
+func (i *sessionIndex) Replace(sessions []*core.CumulocitySession) {
+	i.mu.Lock()
+	i.sessions = make(map[string]*core.CumulocitySession, len(sessions))
+	i.mu.Unlock()
+	i.Add(sessions...)
+}
@@ -0,0 +1,88 @@
+package picker
+
+import (
+	"fmt"
+	"slices"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/reubenmiller/c8y-session-bitwarden/pkg/core"
+)
+
+// multiSelection contains the sessions which were marked in the multi-select mode,
+// in the order they were marked
+type multiSelection struct {
+	uris []string
+}
+
+// Toggle marks or unmarks the session. It returns true if the session is now marked
+func (s *multiSelection) Toggle(uri string) bool {
+	if s.Contains(uri) {
+		s.uris = slices.DeleteFunc(s.uris, func(v string) bool {
+			return v == uri
+		})
+		return false
+	}
+	s.uris = append(s.uris, uri)
+	return true
+}
+
+// Contains returns true if the session is marked
+func (s *multiSelection) Contains(uri string) bool {
+	return s != nil && slices.Contains(s.uris, uri)
+}
+
+// Len returns the number of marked sessions
+func (s *multiSelection) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.uris)
+}
+
+// baseTitle returns the list title, which includes the opened collection in the browse mode, and the
+// number of marked sessions in the multi-select mode
+func (m model) baseTitle() string {
+	title := "Sessions"
+	if m.options.Browse {
+		if m.collection == nil {
+			title = "Folders"
+		} else {
+			title = m.collection.name
+		}
+	}
+	if n := m.marked.Len(); n > 0 {
+		return fmt.Sprintf("%s (%d selected)", title, n)
+	}
+	return title
+}
+
+// toggleMarked marks or unmarks the highlighted session, and moves to the next item
+func (m *model) toggleMarked() tea.Cmd {
+	s := m.selectedSession()
+	if s == nil {
+		return nil
+	}
+	m.marked.Toggle(s.SessionURI)
+	if !m.loading && !m.refreshing {
+		m.list.Title = m.baseTitle()
+	}
+	m.list.CursorDown()
+	return nil
+}
+
+// markedSessions returns the marked sessions which still exist. If no sessions are marked,
+// then the highlighted session is returned
+func (m model) markedSessions() []*core.CumulocitySession {
+	selected := make([]*core.CumulocitySession, 0, m.marked.Len())
+	for _, uri := range m.marked.uris {
+		if s := m.sessions.Get(uri); s != nil {
+			selected = append(selected, s)
+		}
+	}
+	if len(selected) == 0 {
+		if s := m.selectedSession(); s != nil {
+			selected = append(selected, s)
+		}
+	}
+	return selected
+}
@@ -1,125 +1,581 @@
 package picker
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
-	"github.com/muesli/termenv"
+	"github.com/charmbracelet/x/term"
+	"github.com/muesli/reflow/truncate"
 	"github.com/reubenmiller/c8y-session-bitwarden/pkg/core"
 )
 
-var (
-	appStyle = lipgloss.NewStyle().Padding(1, 2)
-
-	titleStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#FFFDF5")).
-			Background(lipgloss.Color("#25A065")).
-			Padding(0, 1)
+var appStyle = lipgloss.NewStyle().Padding(1, 2)
 
-	// activePaginationDotStyle   = lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "235", Dark: "252"}).SetString("•")
-	// inactivePaginationDotStyle = lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "10", Dark: "238"}).SetString("•")
+// totpIndicator marks sessions which have a TOTP secret
+const totpIndicator = "⏱"
 
-	statusMessageStyle = lipgloss.NewStyle().
-				Foreground(lipgloss.AdaptiveColor{Light: "#04B575", Dark: "#04B575"}).
-				Render
-)
+// modeBadge returns a coloured badge of the session mode. Unknown modes are treated as production
+// (like MarshalSessionType), so that production sessions are impossible to miss
+func modeBadge(mode string) string {
+	v, _ := core.MarshalSessionType(mode)
+	return badgeStyle.Copy().Background(modeBadgeColors[v]).Render(strings.ToUpper(v))
+}
 
 type listKeyMap struct {
-	toggleSpinner    key.Binding
 	toggleTitleBar   key.Binding
 	toggleStatusBar  key.Binding
 	togglePagination key.Binding
 	toggleHelpMenu   key.Binding
-	insertItem       key.Binding
+	togglePreview    key.Binding
+	toggleGroup      key.Binding
+	sortColumn       key.Binding
+	sortReverse      key.Binding
+	refresh          key.Binding
+	edit             key.Binding
+	hide             key.Binding
+	pin              key.Binding
+	toggleMark       key.Binding
+	back             key.Binding
 	selectItem       key.Binding
 }
 
-func newListKeyMap() *listKeyMap {
+func newListKeyMap(k KeyBindings) *listKeyMap {
 	return &listKeyMap{
-		insertItem: key.NewBinding(
-			key.WithKeys("a"),
-			key.WithHelp("a", "add item"),
-		),
-		toggleSpinner: key.NewBinding(
-			key.WithKeys("s"),
-			key.WithHelp("s", "toggle spinner"),
-		),
-		toggleTitleBar: key.NewBinding(
-			key.WithKeys("T"),
-			key.WithHelp("T", "toggle title"),
-		),
-		toggleStatusBar: key.NewBinding(
-			key.WithKeys("S"),
-			key.WithHelp("S", "toggle status"),
-		),
-		togglePagination: key.NewBinding(
-			key.WithKeys("P"),
-			key.WithHelp("P", "toggle pagination"),
-		),
-		toggleHelpMenu: key.NewBinding(
-			key.WithKeys("H"),
-			key.WithHelp("H", "toggle help"),
-		),
-		selectItem: key.NewBinding(
-			key.WithKeys("enter"),
-			key.WithHelp("enter", "select"),
-		),
+		toggleTitleBar:   k.binding(ActionToggleTitle),
+		toggleStatusBar:  k.binding(ActionToggleStatus),
+		togglePagination: k.binding(ActionTogglePagination),
+		toggleHelpMenu:   k.binding(ActionToggleHelp),
+		togglePreview:    k.binding(ActionTogglePreview),
+		toggleGroup:      k.binding(ActionToggleGroup),
+		sortColumn:       k.binding(ActionSortColumn),
+		sortReverse:      k.binding(ActionSortReverse),
+		refresh:          k.binding(ActionRefresh),
+		edit:             k.binding(ActionEdit),
+		hide:             k.binding(ActionHide),
+		pin:              k.binding(ActionPin),
+		toggleMark:       k.binding(ActionMark),
+		back:             k.binding(ActionBack),
+		selectItem:       k.binding(ActionChoose),
 	}
 }
 
 type model struct {
-	list          list.Model
-	itemGenerator *randomItemGenerator
-	keys          *listKeyMap
-	delegateKeys  *delegateKeyMap
-	wasSelected   bool
+	list         list.Model
+	keys         *listKeyMap
+	delegateKeys *delegateKeyMap
+	editKeys     *editKeyMap
+	wasSelected  bool
+	quitting     bool
+
+	// maxHeight limits the height of the picker (inline mode). 0 means no limit
+	maxHeight int
+
+	// sessions contains the original sessions (including secrets) by SessionURI
+	sessions *sessionIndex
+
+	// selected are the original sessions which were selected
+	selected []*core.CumulocitySession
+
+	// marked contains the sessions marked in the multi-select mode (nil if not enabled)
+	marked *multiSelection
+
+	// ordered contains the original sessions in the order they should be displayed
+	ordered   []*core.CumulocitySession
+	groupBy   string
+	collapsed map[string]bool
+
+	// table is only set when using the table layout
+	table *tableLayout
+
+	width         int
+	height        int
+	showPreview   bool
+	previewTickID int
+
+	clipboardTimeout time.Duration
+
+	// pendingClipboard is the secret which is still to be removed from the clipboard
+	pendingClipboard string
+
+	// loadCh receives the progress of the loader (if the sessions are loaded in the background)
+	ctx     context.Context
+	loadCh  <-chan tea.Msg
+	loading bool
+	loadErr error
+
+	// refreshing is set whilst the sessions are reloaded using the Refresh loader
+	refreshing bool
+
+	// reselect is the SessionURI which should be highlighted once the filter has been reapplied
+	reselect string
+
+	// edit is the form which is shown instead of the list whilst editing a session
+	edit *editForm
+
+	// collection is the folder or organization which was opened in the browse mode. Nil shows the
+	// list of collections
+	collection *collection
+
+	// totpTicking is set whilst a tick to refresh the TOTP code of the highlighted session is pending
+	totpTicking bool
+
+	// filterStatus is the error (or warning) of the filter query which is shown below the list, e.g. a missing quote
+	filterStatus string
+
+	// options are used to decide if a session should be selected automatically once loaded
+	options PickerOptions
 }
 
-func newModel(itemGenerator randomItemGenerator) model {
+func newModel(sessions []*core.CumulocitySession, options PickerOptions) model {
 
+	keyBindings := options.Keys
+	if keyBindings == nil {
+		keyBindings = defaultKeyBindings()
+	}
 	var (
-		delegateKeys = newDelegateKeyMap()
-		listKeys     = newListKeyMap()
+		delegateKeys = newDelegateKeyMap(keyBindings)
+		listKeys     = newListKeyMap(keyBindings)
+		editKeys     = newEditKeyMap(keyBindings)
 	)
 
-	// Make initial list of items
-	// const numItems = 24
-	items := make([]list.Item, itemGenerator.Len())
-	for i := 0; i < itemGenerator.Len(); i++ {
-		items[i] = itemGenerator.Next()
+	// Only the list items are visible to the user, so they don't contain any secrets.
+	// The original sessions are used when an action needs the secrets
+	lookup := newSessionIndex(sessions)
+	collapsed := make(map[string]bool)
+	items := groupItems(sessions, options.GroupBy, collapsed)
+	if options.Browse {
+		items = collectionItems(sessions)
+	}
+
+	var marked *multiSelection
+	if options.Multi {
+		marked = &multiSelection{}
 	}
 
 	// Setup list
-	delegate := newItemDelegate(delegateKeys)
+	var table *tableLayout
+	var delegate list.ItemDelegate = newItemDelegate(delegateKeys, lookup, options.Prefs, marked)
+	if options.Layout == LayoutTable {
+		table = newTableLayout(options.Columns)
+		delegate = tableDelegate{
+			itemDelegate: delegate.(itemDelegate),
+			table:        table,
+		}
+	}
 	sessionList := list.New(items, delegate, 0, 0)
 	sessionList.Title = "Sessions"
-	sessionList.Styles.Title = titleStyle
-
-	// sessionList.Styles.ActivePaginationDot = activePaginationDotStyle
-	// sessionList.Styles.InactivePaginationDot = inactivePaginationDotStyle
+	if options.Browse {
+		sessionList.Title = "Folders"
+	}
+	setListStyles(&sessionList)
+	sessionList.KeyMap = keyBindings.listKeyMap()
+	sessionList.StatusMessageLifetime = 5 * time.Second
+	sessionList.Filter = queryFilter(lookup, options.Prefs)
+	if options.Loader != nil {
+		sessionList.Title = loadingTitle("loading")
+		sessionList.StartSpinner()
+	}
 
 	sessionList.AdditionalFullHelpKeys = func() []key.Binding {
-		return []key.Binding{
-			listKeys.toggleSpinner,
-			listKeys.insertItem,
+		bindings := []key.Binding{
 			listKeys.toggleTitleBar,
 			listKeys.toggleStatusBar,
 			listKeys.togglePagination,
 			listKeys.toggleHelpMenu,
-			listKeys.selectItem,
+			listKeys.togglePreview,
+			listKeys.toggleGroup,
+		}
+		if table != nil {
+			bindings = append(bindings, listKeys.sortColumn, listKeys.sortReverse)
+		}
+		if options.Refresh != nil {
+			bindings = append(bindings, listKeys.refresh)
+		}
+		if options.Save != nil {
+			bindings = append(bindings, listKeys.edit)
+		}
+		if options.Prefs != nil {
+			bindings = append(bindings, listKeys.hide, listKeys.pin)
 		}
+		if options.Multi {
+			bindings = append(bindings, listKeys.toggleMark)
+		}
+		if options.Browse {
+			bindings = append(bindings, listKeys.back)
+		}
+		return append(bindings, listKeys.selectItem)
+	}
+
+	clipboardTimeout := options.ClipboardTimeout
+	if clipboardTimeout <= 0 {
+		clipboardTimeout = DefaultClipboardTimeout
 	}
 
 	return model{
-		list:          sessionList,
-		keys:          listKeys,
-		delegateKeys:  delegateKeys,
-		itemGenerator: &itemGenerator,
+		list:             sessionList,
+		keys:             listKeys,
+		delegateKeys:     delegateKeys,
+		editKeys:         editKeys,
+		sessions:         lookup,
+		ordered:          sessions,
+		groupBy:          options.GroupBy,
+		collapsed:        collapsed,
+		table:            table,
+		showPreview:      options.ShowPreview,
+		clipboardTimeout: clipboardTimeout,
+		maxHeight:        options.Height,
+		loading:          options.Loader != nil,
+		marked:           marked,
+		options:          options,
+	}
+}
+
+// queryFilter returns a list filter which uses the query language of core.ParseQuery.
+// If the filter text is not a valid query (e.g. whilst still typing a quoted phrase),
+// then the text is matched literally (and the error is shown below the list). Pinned sessions are shown first
+func queryFilter(sessions *sessionIndex, prefs Preferences) list.FilterFunc {
+	return func(term string, targets []string) []list.Rank {
+		query, err := core.ParseQuery(term)
+		ranks := make([]list.Rank, 0)
+		scores := make(map[int]int)
+		pinned := make(map[int]int)
+		for i, target := range targets {
+			// The filter value starts with the SessionURI (group headers have an empty filter value)
+			uri, _, _ := strings.Cut(target, " ")
+			s := sessions.Get(uri)
+			if s == nil {
+				// e.g. folders in the browse mode
+				if target != "" && strings.Contains(strings.ToLower(target), strings.ToLower(term)) {
+					pinned[i] = 1
+					ranks = append(ranks, list.Rank{Index: i})
+				}
+				continue
+			}
+			pinned[i] = pinnedRank(prefs, s.SessionURI)
+			if err != nil {
+				if core.MatchSession(s, term) {
+					ranks = append(ranks, list.Rank{Index: i})
+				}
+			} else if score, ok := query.Rank(s); ok {
+				scores[i] = score
+				ranks = append(ranks, list.Rank{Index: i})
+			}
+		}
+
+		// Show the most relevant matches first
+		slices.SortStableFunc(ranks, func(a, b list.Rank) int {
+			if pinned[a.Index] != pinned[b.Index] {
+				return pinned[a.Index] - pinned[b.Index]
+			}
+			return scores[b.Index] - scores[a.Index]
+		})
+		return ranks
+	}
+}
+
+// selectedSession returns the original session of the highlighted item
+func (m model) selectedSession() *core.CumulocitySession {
+	if i, ok := m.list.SelectedItem().(*core.CumulocitySession); ok {
+		return m.sessions.Get(i.SessionURI)
+	}
+	return nil
+}
+
+// refreshItems rebuilds the list items, e.g. after the sort order was changed or a group was collapsed
+func (m *model) refreshItems() tea.Cmd {
+	sessions := m.ordered
+	if m.options.Browse {
+		if m.collection == nil {
+			return m.list.SetItems(collectionItems(sessions))
+		}
+		sessions = slices.DeleteFunc(slices.Clone(sessions), func(s *core.CumulocitySession) bool {
+			return !m.collection.contains(s)
+		})
+	}
+	if m.table != nil {
+		sessions = m.table.sort(sessions)
+	}
+	return m.list.SetItems(groupItems(sessions, m.groupBy, m.collapsed))
+}
+
+// toggleGroup collapses or expands the group of the highlighted item
+func (m *model) toggleGroup() tea.Cmd {
+	var name string
+	switch i := m.list.SelectedItem().(type) {
+	case *groupHeader:
+		name = i.name
+	case *core.CumulocitySession:
+		name = groupKey(m.sessions.Get(i.SessionURI), m.groupBy)
+	default:
+		return nil
+	}
+	m.collapsed[name] = !m.collapsed[name]
+	cmd := m.refreshItems()
+
+	// Keep the group header highlighted
+	for index, item := range m.list.Items() {
+		if h, ok := item.(*groupHeader); ok && h.name == name {
+			m.list.Select(index)
+			break
+		}
 	}
+	return cmd
+}
+
+// previewOnSide returns true if the preview should be shown next to the list rather than below it
+func (m model) previewOnSide() bool {
+	return m.width >= previewSideMinWidth
+}
+
+// resize sets the size of the list based on the window size and the preview layout
+func (m *model) resize() {
+	h, v := appStyle.GetFrameSize()
+	height := m.height
+	if m.maxHeight > 0 {
+		height = min(height, m.maxHeight)
+	}
+	width, height := m.width-h, height-v
+	if m.loadErr != nil {
+		height -= lipgloss.Height(m.loadErrView())
+	}
+	if m.filterStatus != "" {
+		height -= lipgloss.Height(m.filterStatus)
+	}
+	if m.showPreview {
+		if m.previewOnSide() {
+			width -= previewSideWidth
+		} else {
+			height -= previewBottomHeight
+		}
+	}
+	if m.table != nil {
+		// Leave room for the table header, and the cursor in front of each row
+		height--
+		m.table.resize(width-m.tablePrefixWidth(), m.ordered)
+	}
+	m.list.SetSize(max(width, 0), max(height, 0))
+}
+
+// tablePrefixWidth returns the width of the cursor, marker and checkbox in front of each table row
+func (m model) tablePrefixWidth() int {
+	if m.marked != nil {
+		return 6
+	}
+	return 2
+}
+
+// listView renders the list. The table layout inserts the column headers between the
+// title/status bar and the items
+func (m model) listView() string {
+	if m.table == nil {
+		return m.list.View()
+	}
+	offset := 0
+	if m.list.ShowTitle() || (m.list.ShowFilter() && m.list.FilteringEnabled()) {
+		offset += lipgloss.Height(m.list.Styles.TitleBar.Render(" "))
+	}
+	if m.list.ShowStatusBar() {
+		offset += lipgloss.Height(m.list.Styles.StatusBar.Render(" "))
+	}
+	lines := strings.Split(m.list.View(), "\n")
+	offset = min(offset, len(lines))
+	header := strings.Repeat(" ", m.tablePrefixWidth()) + tableHeaderStyle.Render(m.table.header())
+	if m.options.Browse && m.collection == nil {
+		// The columns don't apply to the folders, but keep the line so that the height doesn't change
+		header = ""
+	}
+	return strings.Join(slices.Insert(lines, offset, header), "\n")
+}
+
+// updateFilterStatus parses the filter text so that an invalid query (or a warning, e.g. a likely typo of a field)
+// is shown whilst filtering. The filter still matches the text literally in this case. It returns true if the status changed
+func (m *model) updateFilterStatus() bool {
+	status := ""
+	if m.list.FilterState() != list.Unfiltered && !(m.options.Browse && m.collection == nil) {
+		query, err := core.ParseQuery(m.list.FilterValue())
+		queryErr := &core.QueryError{}
+		switch {
+		case errors.As(err, &queryErr):
+			status = statusErrorStyle(fmt.Sprintf("✘ Invalid query at position %d: %s", queryErr.Position+1, queryErr.Message))
+		case err == nil && len(query.Warnings()) > 0:
+			warning := query.Warnings()[0]
+			status = statusMessageStyle(fmt.Sprintf("⚠ Position %d: %s", warning.Position+1, warning.Message))
+		}
+		status = truncate.StringWithTail(status, uint(max(m.list.Width(), 0)), "…")
+	}
+	changed := status != m.filterStatus
+	m.filterStatus = status
+	return changed
+}
+
+// loadingTitle returns the list title which shows the progress of the loader
+func loadingTitle(status string) string {
+	return "Sessions · " + status + "…"
+}
+
+// loadErrView renders the error of the loader
+func (m model) loadErrView() string {
+	return statusErrorStyle("✘ Could not load sessions. " + m.loadErr.Error())
+}
+
+// autoSelect returns the session which should be selected without asking the user, if any
+func autoSelect(sessions []*core.CumulocitySession, options PickerOptions) *core.CumulocitySession {
+	if options.AutoSelectIfOnlyOne && len(sessions) == 1 {
+		return sessions[0]
+	}
+	if options.AutoSelectBestMatch && options.Query != nil {
+		if best, ok := core.BestMatch(options.Query, sessions); ok {
+			return best
+		}
+	}
+	return nil
+}
+
+// loadDone replaces the streamed sessions with the final list of the loader. The session is selected
+// automatically (like when not using a loader), unless the user already started filtering
+func (m model) loadDone(msg loadDoneMsg) (tea.Model, tea.Cmd) {
+	m.loading = false
+	m.list.StopSpinner()
+	m.list.Title = m.baseTitle()
+
+	if msg.err != nil {
+		// Keep the picker open so that the user can see the error
+		m.loadErr = msg.err
+		m.resize()
+		return m, nil
+	}
+
+	m.ordered = msg.sessions
+	m.sessions.Replace(msg.sessions)
+
+	if len(msg.sessions) == 0 {
+		m.loadErr = ErrNoSessions
+		m.quitting = true
+		return m, tea.Quit
+	}
+
+	if m.list.FilterState() == list.Unfiltered {
+		if selected := autoSelect(msg.sessions, m.options); selected != nil {
+			m.selected = []*core.CumulocitySession{selected}
+			m.wasSelected = true
+			m.quitting = true
+			return m, tea.Quit
+		}
+	}
+
+	m.resize()
+	return m, m.refreshItems()
+}
+
+// startRefresh reloads the sessions in the background
+func (m *model) startRefresh() tea.Cmd {
+	if m.loading || m.refreshing || m.options.Refresh == nil {
+		return nil
+	}
+	m.refreshing = true
+	m.list.Title = loadingTitle("syncing")
+	m.loadCh = startLoad(m.ctx, m.options.Refresh)
+	return tea.Batch(m.list.StartSpinner(), waitForLoad(m.loadCh))
+}
+
+// refreshDone merges the reloaded sessions into the list, keeping the highlighted session and the filter
+func (m model) refreshDone(msg loadDoneMsg) (tea.Model, tea.Cmd) {
+	m.refreshing = false
+	m.list.StopSpinner()
+	m.list.Title = m.baseTitle()
+
+	if msg.err != nil {
+		return m, m.list.NewStatusMessage(statusErrorStyle("Could not refresh sessions. " + msg.err.Error()))
+	}
+
+	added, removed := 0, 0
+	current := make(map[string]bool, len(msg.sessions))
+	for _, s := range msg.sessions {
+		current[s.SessionURI] = true
+		if m.sessions.Get(s.SessionURI) == nil {
+			added++
+		}
+	}
+	for _, s := range m.ordered {
+		if !current[s.SessionURI] {
+			removed++
+		}
+	}
+
+	var uri string
+	if s := m.selectedSession(); s != nil {
+		uri = s.SessionURI
+	}
+
+	m.ordered = msg.sessions
+	m.sessions.Replace(msg.sessions)
+	m.resize()
+	cmd := m.refreshItems()
+	if !m.selectURI(uri) {
+		// The filter is reapplied in the background, so select the session once it is done
+		m.reselect = uri
+	}
+	return m, tea.Batch(cmd, m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("Refreshed sessions: %d added, %d removed", added, removed))))
+}
+
+// selectURI highlights the session with the given SessionURI. False is returned if the session is not visible
+func (m *model) selectURI(uri string) bool {
+	if uri == "" {
+		return false
+	}
+	for index, item := range m.list.VisibleItems() {
+		if s, ok := item.(*core.CumulocitySession); ok && s.SessionURI == uri {
+			m.list.Select(index)
+			return true
+		}
+	}
+	return false
+}
+
+// startEdit opens the edit form of the highlighted session
+func (m *model) startEdit() tea.Cmd {
+	s := m.selectedSession()
+	if s == nil || m.loading {
+		return nil
+	}
+	m.edit = newEditForm(s, m.editKeys)
+	return textinput.Blink
+}
+
+// editSaved replaces the edited session in the list
+func (m model) editSaved(msg editSavedMsg) (tea.Model, tea.Cmd) {
+	if msg.err != nil {
+		if m.edit != nil {
+			m.edit.saving = false
+			m.edit.err = msg.err
+		}
+		return m, nil
+	}
+
+	m.edit = nil
+	for i, s := range m.ordered {
+		if s.SessionURI == msg.uri {
+			m.ordered[i] = msg.session
+		}
+	}
+	m.sessions.Add(msg.session)
+	cmd := m.refreshItems()
+	if !m.selectURI(msg.session.SessionURI) {
+		m.reselect = msg.session.SessionURI
+	}
+	return m, tea.Batch(cmd, m.list.NewStatusMessage(statusMessageStyle("Saved "+msg.session.Title())))
 }
 
 func (m model) WasSelected() bool {
@@ -127,19 +583,132 @@ func (m model) WasSelected() bool {
 }
 
 func (m model) Init() tea.Cmd {
-	// TODO: How to detect a fitting profile
-	lipgloss.SetColorProfile(termenv.TrueColor)
-	// lipgloss.SetColorProfile(termenv.ANSI256)
-	return nil
+	var cmds []tea.Cmd
+	if m.showPreview {
+		cmds = append(cmds, previewTick(m.previewTickID))
+	}
+	if m.loading {
+		// The spinner was already started by newModel, this only starts its ticks
+		cmds = append(cmds, m.list.StartSpinner(), waitForLoad(m.loadCh))
+	}
+	return tea.Batch(cmds...)
+}
+
+// needsTOTPTick returns true if the TOTP code of the highlighted session is visible
+func (m model) needsTOTPTick() bool {
+	if m.quitting || m.edit != nil || m.list.FilterState() == list.Filtering {
+		return false
+	}
+	s := m.selectedSession()
+	return s != nil && s.TOTPSecret != ""
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if _, ok := msg.(totpTickMsg); ok {
+		m.totpTicking = false
+	}
+	updated, cmd := m.update(msg)
+	next := updated.(model)
+
+	if next.updateFilterStatus() {
+		next.resize()
+	}
+
+	// Only keep ticking whilst a TOTP code is shown
+	if !next.totpTicking && next.needsTOTPTick() {
+		next.totpTicking = true
+		cmd = tea.Batch(cmd, totpTick())
+	}
+	return next, cmd
+}
+
+func (m model) update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmds []tea.Cmd
 
+	if msg, ok := msg.(tea.KeyMsg); ok && m.edit != nil {
+		if key.Matches(msg, m.list.KeyMap.ForceQuit) {
+			// ctrl+c always cancels the picker, even whilst editing
+			m.quitting = true
+			return m, tea.Quit
+		}
+		cmd, done := m.edit.Update(m.ctx, msg, m.options.Save)
+		if done {
+			m.edit = nil
+		}
+		return m, cmd
+	}
+
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
-		h, v := appStyle.GetFrameSize()
-		m.list.SetSize(msg.Width-h, msg.Height-v)
+		m.width, m.height = msg.Width, msg.Height
+		m.resize()
+
+	case totpTickMsg:
+		// Nothing to do, the view is rendered again
+		return m, nil
+
+	case previewTickMsg:
+		// Keep refreshing the preview (e.g. TOTP countdown) whilst it is visible
+		if msg.id == m.previewTickID && m.showPreview {
+			return m, previewTick(m.previewTickID)
+		}
+		return m, nil
+
+	case loadProgressMsg:
+		m.list.Title = loadingTitle(msg.status)
+		return m, waitForLoad(m.loadCh)
+
+	case loadBatchMsg:
+		if m.refreshing {
+			// The sessions are merged once the refresh is done
+			return m, waitForLoad(m.loadCh)
+		}
+		m.sessions.Add(msg.sessions...)
+		m.ordered = append(m.ordered, msg.sessions...)
+		m.resize()
+		return m, tea.Batch(m.refreshItems(), waitForLoad(m.loadCh))
+
+	case editSavedMsg:
+		return m.editSaved(msg)
+
+	case loadDoneMsg:
+		if m.refreshing {
+			return m.refreshDone(msg)
+		}
+		return m.loadDone(msg)
+
+	case list.FilterMatchesMsg:
+		if m.reselect != "" {
+			newListModel, cmd := m.list.Update(msg)
+			m.list = newListModel
+			m.selectURI(m.reselect)
+			m.reselect = ""
+			return m, cmd
+		}
+
+	case statusMsg:
+		if msg.isErr {
+			return m, m.list.NewStatusMessage(statusErrorStyle(msg.text))
+		}
+		return m, m.list.NewStatusMessage(statusMessageStyle(msg.text))
+
+	case clipboardCopiedMsg:
+		if !msg.secret {
+			return m, m.list.NewStatusMessage(statusMessageStyle("Copied " + msg.label))
+		}
+		m.pendingClipboard = msg.value
+		clearCmd := tea.Tick(m.clipboardTimeout, func(time.Time) tea.Msg {
+			return clipboardClearMsg{value: msg.value}
+		})
+		statusCmd := m.list.NewStatusMessage(statusMessageStyle(fmt.Sprintf("Copied %s (clears in %s)", msg.label, m.clipboardTimeout)))
+		return m, tea.Batch(clearCmd, statusCmd)
+
+	case clipboardClearMsg:
+		clearClipboard(msg.value)
+		if m.pendingClipboard == msg.value {
+			m.pendingClipboard = ""
+		}
+		return m, nil
 
 	case tea.KeyMsg:
 		// Don't match any of the keys below if we're actively filtering.
@@ -148,9 +717,12 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 
 		switch {
-		case key.Matches(msg, m.keys.toggleSpinner):
-			cmd := m.list.ToggleSpinner()
-			return m, cmd
+		case key.Matches(msg, m.list.KeyMap.ClearFilter) && m.list.FilterState() == list.FilterApplied:
+			// Let the list clear the filter
+
+		case key.Matches(msg, m.delegateKeys.cancel, m.list.KeyMap.Quit, m.list.KeyMap.ForceQuit):
+			m.quitting = true
+			return m, tea.Quit
 
 		case key.Matches(msg, m.keys.toggleTitleBar):
 			v := !m.list.ShowTitle()
@@ -171,19 +743,75 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.list.SetShowHelp(!m.list.ShowHelp())
 			return m, nil
 
-		case key.Matches(msg, m.keys.insertItem):
-			m.delegateKeys.remove.SetEnabled(true)
-			newItem := m.itemGenerator.Next()
-			insCmd := m.list.InsertItem(0, newItem)
-			statusCmd := m.list.NewStatusMessage(statusMessageStyle("Added " + newItem.Title()))
-			return m, tea.Batch(insCmd, statusCmd)
+		case key.Matches(msg, m.keys.togglePreview):
+			m.showPreview = !m.showPreview
+			m.resize()
+			if m.showPreview {
+				m.previewTickID++
+				return m, previewTick(m.previewTickID)
+			}
+			return m, nil
+
+		case key.Matches(msg, m.keys.toggleGroup):
+			if m.groupBy == GroupByNone {
+				break
+			}
+			return m, m.toggleGroup()
+
+		case m.table != nil && key.Matches(msg, m.keys.sortColumn):
+			m.table.nextSortColumn()
+			return m, m.refreshItems()
+
+		case m.options.Refresh != nil && key.Matches(msg, m.keys.refresh):
+			return m, m.startRefresh()
+
+		case m.options.Save != nil && key.Matches(msg, m.keys.edit):
+			return m, m.startEdit()
+
+		case m.marked != nil && key.Matches(msg, m.keys.toggleMark):
+			return m, m.toggleMarked()
+
+		case m.options.Prefs != nil && key.Matches(msg, m.keys.hide):
+			return m, m.toggleHidden()
+
+		case m.options.Prefs != nil && key.Matches(msg, m.keys.pin):
+			return m, m.togglePinned()
+
+		case m.table != nil && key.Matches(msg, m.keys.sortReverse):
+			m.table.sortDesc = !m.table.sortDesc
+			return m, m.refreshItems()
+
+		case m.options.Browse && m.collection != nil && key.Matches(msg, m.keys.back):
+			return m, m.closeCollection()
 
 		case key.Matches(msg, m.keys.selectItem):
-			m.wasSelected = true
+			if _, ok := m.list.SelectedItem().(*groupHeader); ok {
+				return m, m.toggleGroup()
+			}
+			if c, ok := m.list.SelectedItem().(*collection); ok {
+				return m, m.openCollection(c)
+			}
+			if m.loading {
+				// The session might still be replaced by the loader
+				return m, m.list.NewStatusMessage(statusErrorStyle("Sessions are still loading"))
+			}
+			if m.marked != nil {
+				m.selected = m.markedSessions()
+			} else if s := m.selectedSession(); s != nil {
+				m.selected = []*core.CumulocitySession{s}
+			}
+			m.wasSelected = len(m.selected) > 0
+			m.quitting = true
 			return m, tea.Quit
 		}
 	}
 
+	if m.edit != nil {
+		// e.g. cursor blinking
+		cmd, _ := m.edit.Update(m.ctx, msg, m.options.Save)
+		cmds = append(cmds, cmd)
+	}
+
 	// This will also call our delegate's update function.
 	newListModel, cmd := m.list.Update(msg)
 	m.list = newListModel
@@ -193,37 +821,241 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 }
 
 func (m model) View() string {
-	return appStyle.Render(m.list.View())
+	if m.quitting && m.maxHeight > 0 {
+		// Remove the inline picker from the terminal, a summary is printed instead
+		return ""
+	}
+	if m.edit != nil {
+		return appStyle.Render(m.edit.View(m.list.Width()))
+	}
+	view := m.listView()
+	if m.filterStatus != "" {
+		view = lipgloss.JoinVertical(lipgloss.Left, view, m.filterStatus)
+	}
+	if m.showPreview {
+		if m.previewOnSide() {
+			preview := renderPreview(m.selectedSession(), previewSideWidth, lipgloss.Height(view))
+			view = lipgloss.JoinHorizontal(lipgloss.Top, view, preview)
+		} else {
+			preview := renderPreview(m.selectedSession(), m.list.Width(), previewBottomHeight)
+			view = lipgloss.JoinVertical(lipgloss.Left, view, preview)
+		}
+	}
+	if m.loadErr != nil {
+		view = lipgloss.JoinVertical(lipgloss.Left, m.loadErrView(), view)
+	}
+	return appStyle.Render(view)
 }
 
+var (
+	// ErrCancelled is returned when the user cancelled the selection (or the context was cancelled)
+	ErrCancelled = errors.New("session selection was cancelled")
+
+	// ErrNoSessions is returned when there are no sessions to pick from
+	ErrNoSessions = errors.New("no sessions found")
+)
+
 type PickerOptions struct {
+	// Backend used to select the session. See Backends for the supported values. The builtin
+	// picker is used if the backend is not set, or if the external tool is not installed
+	Backend string
+
 	// AutoSelectIfOnlyOne if enabled will automatically select a session if there is only one session in the list (without requiring users approval)
 	AutoSelectIfOnlyOne bool
+
+	// AutoSelectBestMatch if enabled will automatically select a session if it is clearly the best match
+	// of the Query (see core.BestMatch), e.g. an exact host or tenant match
+	AutoSelectBestMatch bool
+
+	// Query used to select the sessions. It is used to find the best match
+	Query *core.Query
+
+	// Input the picker reads the user input from. Defaults to stdin
+	Input io.Reader
+
+	// Output the picker is rendered to. Defaults to stderr so that stdout can be used for the selected session
+	Output io.Writer
+
+	// ClipboardTimeout is the duration after which secrets copied from the picker are removed from
+	// the clipboard. Secrets which are still in the clipboard when the picker exits are removed immediately
+	ClipboardTimeout time.Duration
+
+	// ShowPreview shows the detail preview of the highlighted session when the picker is opened
+	ShowPreview bool
+
+	// Layout controls how the sessions are rendered. See Layouts for the supported values
+	Layout string
+
+	// Columns are the columns shown in the table layout. See TableColumns for the supported values
+	Columns []string
+
+	// GroupBy groups the sessions under collapsible section headers, e.g. by folder or mode.
+	// See GroupByOptions for the supported values
+	GroupBy string
+
+	// Loader loads the sessions in the background whilst the picker is shown. The sessions passed
+	// to Pick are ignored if it is set. External backends wait for the loader before they are started
+	Loader Loader
+
+	// Refresh reloads the sessions when the user presses the refresh key, e.g. after syncing the vault.
+	// The refresh key is only enabled if it is set
+	Refresh Loader
+
+	// Save writes the changes of the edit form back to the vault. Sessions can only be edited if it is set
+	Save SaveFunc
+
+	// Prefs stores the hidden and pinned sessions. Sessions can only be hidden or pinned if it is set.
+	// The sessions are expected to already be filtered and sorted using the preferences
+	Prefs Preferences
+
+	// Multi enables the multi-select mode, in which several sessions can be marked (space) and selected at once
+	Multi bool
+
+	// Browse enables the browse mode, in which a folder or organization is chosen first before its
+	// sessions are listed
+	Browse bool
+
+	// Theme contains the colours of the builtin picker. The default theme is used if it is not set
+	Theme *Theme
+
+	// Keys are the key bindings of the builtin picker. The default key bindings are used if it is not set
+	Keys KeyBindings
+
+	// Height of the picker in rows. If set, the picker is drawn inline (below the prompt) rather than using
+	// the alternate screen, and a summary of the selection is printed when done. If not set, the inline
+	// mode is used automatically when the terminal has fewer rows than InlineThreshold
+	Height int
 }
 
-func Pick(sessions []*core.CumulocitySession, options PickerOptions) (*core.CumulocitySession, error) {
+// InlineThreshold is the terminal height (in rows) below which the inline mode is used by default
+const InlineThreshold = 25
 
-	if options.AutoSelectIfOnlyOne && len(sessions) == 1 {
-		return sessions[0], nil
+// terminalHeight returns the number of rows of the terminal which the picker is rendered to
+func terminalHeight(output io.Writer) int {
+	f, ok := output.(*os.File)
+	if !ok {
+		return 0
+	}
+	_, height, err := term.GetSize(f.Fd())
+	if err != nil {
+		return 0
+	}
+	return height
+}
+
+// Pick lets the user interactively select a session, or several sessions in the multi-select mode.
+// ErrCancelled is returned if the user cancels the selection, and ErrNoSessions if there is nothing to select
+func Pick(ctx context.Context, sessions []*core.CumulocitySession, options PickerOptions) ([]*core.CumulocitySession, error) {
+	output := options.Output
+	if output == nil {
+		output = os.Stderr
+	}
+
+	if isBuiltin(options.Backend) && !hasCursorAddressing() {
+		slog.Info("Terminal does not support cursor addressing, so using the prompt picker instead.", "term", os.Getenv("TERM"))
+		options.Backend = BackendPrompt
+	}
+
+	theme := options.Theme
+	if theme == nil {
+		theme = themes[ThemeDefault]()
+	}
+	detectColors(output)
+	applyTheme(theme)
+
+	if options.Loader != nil && !isBuiltin(options.Backend) {
+		// External pickers need all of the sessions up front
+		if options.Backend == BackendPrompt {
+			fmt.Fprintln(output, "Loading sessions...")
+		}
+		loaded, err := options.Loader(ctx, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		sessions, options.Loader = loaded, nil
+	}
+
+	if options.Loader == nil {
+		if len(sessions) == 0 {
+			return nil, ErrNoSessions
+		}
+
+		if selected := autoSelect(sessions, options); selected != nil {
+			return []*core.CumulocitySession{selected}, nil
+		}
+
+		if selected, ok, err := pickWithBackend(ctx, sessions, options); ok {
+			return selected, err
+		}
 	}
 
-	itemGenerator := randomItemGenerator{
-		sessions: sessions,
+	if options.Height <= 0 {
+		if rows := terminalHeight(output); rows > 0 && rows < InlineThreshold {
+			options.Height = rows - 1
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	programOptions := []tea.ProgramOption{
+		tea.WithContext(ctx),
+		tea.WithOutput(output),
+	}
+	if options.Height <= 0 {
+		programOptions = append(programOptions, tea.WithAltScreen())
+	}
+	if options.Input != nil {
+		programOptions = append(programOptions, tea.WithInput(options.Input))
+	}
+
+	initialModel := newModel(sessions, options)
+	initialModel.ctx = ctx
+	if options.Loader != nil {
+		initialModel.loadCh = startLoad(ctx, options.Loader)
 	}
 
-	m, err := tea.NewProgram(newModel(itemGenerator), tea.WithAltScreen(), tea.WithOutput(os.Stderr)).Run()
+	m, err := tea.NewProgram(initialModel, programOptions...).Run()
 	if err != nil {
-		// fmt.Println("Error running program:", err)
-		os.Exit(1)
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("%w. %w", ErrCancelled, ctx.Err())
+		}
+		return nil, fmt.Errorf("failed to run picker. %w", err)
 	}
 
 	session := m.(model)
 
+	if session.pendingClipboard != "" {
+		clearClipboard(session.pendingClipboard)
+	}
+
+	var selected []*core.CumulocitySession
 	if session.WasSelected() {
-		if selectedSession, ok := session.list.SelectedItem().(*core.CumulocitySession); ok {
-			return selectedSession, nil
+		selected = session.selected
+	}
+
+	if len(selected) == 0 && session.loadErr != nil {
+		return nil, session.loadErr
+	}
+
+	if options.Height > 0 {
+		// Keep some context in the terminal history
+		switch len(selected) {
+		case 0:
+			fmt.Fprintln(output, statusErrorStyle("✘ Session selection cancelled"))
+		case 1:
+			fmt.Fprintf(output, "%s %s (%s)\n", statusMessageStyle("✔ Selected"), selected[0].Title(), selected[0].Description())
+		default:
+			titles := make([]string, 0, len(selected))
+			for _, s := range selected {
+				titles = append(titles, s.Title())
+			}
+			fmt.Fprintf(output, "%s %d sessions: %s\n", statusMessageStyle("✔ Selected"), len(selected), strings.Join(titles, ", "))
 		}
 	}
 
-	return nil, fmt.Errorf("empty")
+	if len(selected) == 0 {
+		return nil, ErrCancelled
+	}
+	return selected, nil
 }
@@ -0,0 +1,80 @@
+package picker
+
+import (
+	"slices"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/reubenmiller/c8y-session-bitwarden/pkg/core"
+)
+
+// Preferences stores which sessions are hidden or pinned. It must be safe for concurrent use
+type Preferences interface {
+	IsHidden(sessionURI string) bool
+	IsPinned(sessionURI string) bool
+	SetHidden(sessionURI string, hidden bool) error
+	SetPinned(sessionURI string, pinned bool) error
+}
+
+// sortPinned returns a copy of the sessions with the pinned sessions first
+func sortPinned(sessions []*core.CumulocitySession, prefs Preferences) []*core.CumulocitySession {
+	sorted := slices.Clone(sessions)
+	if prefs == nil {
+		return sorted
+	}
+	slices.SortStableFunc(sorted, func(a, b *core.CumulocitySession) int {
+		return pinnedRank(prefs, a.SessionURI) - pinnedRank(prefs, b.SessionURI)
+	})
+	return sorted
+}
+
+// pinnedRank returns 0 for pinned sessions, and 1 for all others
+func pinnedRank(prefs Preferences, sessionURI string) int {
+	if prefs != nil && prefs.IsPinned(sessionURI) {
+		return 0
+	}
+	return 1
+}
+
+// toggleHidden hides the highlighted session (removing it from the list), or unhides it if it
+// is already hidden (e.g. when hidden sessions are included)
+func (m *model) toggleHidden() tea.Cmd {
+	s := m.selectedSession()
+	if s == nil || m.loading {
+		return nil
+	}
+	hidden := !m.options.Prefs.IsHidden(s.SessionURI)
+	if err := m.options.Prefs.SetHidden(s.SessionURI, hidden); err != nil {
+		return m.list.NewStatusMessage(statusErrorStyle("Could not save preferences. " + err.Error()))
+	}
+	if !hidden {
+		return tea.Batch(m.refreshItems(), m.list.NewStatusMessage(statusMessageStyle("Unhidden "+s.Title())))
+	}
+
+	m.ordered = slices.DeleteFunc(slices.Clone(m.ordered), func(v *core.CumulocitySession) bool {
+		return v.SessionURI == s.SessionURI
+	})
+	return tea.Batch(m.refreshItems(), m.list.NewStatusMessage(statusMessageStyle("Hidden "+s.Title()+" (use --show-hidden to list it)")))
+}
+
+// togglePinned pins or unpins the highlighted session. Pinned sessions are moved to the top
+func (m *model) togglePinned() tea.Cmd {
+	s := m.selectedSession()
+	if s == nil || m.loading {
+		return nil
+	}
+	pinned := !m.options.Prefs.IsPinned(s.SessionURI)
+	if err := m.options.Prefs.SetPinned(s.SessionURI, pinned); err != nil {
+		return m.list.NewStatusMessage(statusErrorStyle("Could not save preferences. " + err.Error()))
+	}
+
+	m.ordered = sortPinned(m.ordered, m.options.Prefs)
+	cmd := m.refreshItems()
+	if !m.selectURI(s.SessionURI) {
+		m.reselect = s.SessionURI
+	}
+	status := "Unpinned "
+	if pinned {
+		status = "Pinned "
+	}
+	return tea.Batch(cmd, m.list.NewStatusMessage(statusMessageStyle(status+s.Title())))
+}
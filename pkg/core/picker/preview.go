@@ -0,0 +1,130 @@
+package picker
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/reubenmiller/c8y-session-bitwarden/pkg/core"
+)
+
+const (
+	// previewSideMinWidth is the minimum window width required to show the preview next to the list.
+	// Narrower windows show the preview below the list
+	previewSideMinWidth = 120
+
+	previewSideWidth    = 48
+	previewBottomHeight = 12
+
+	totpPeriod   = 30
+	totpBarWidth = 6
+)
+
+// previewTickMsg is used to refresh the preview, e.g. the TOTP countdown
+type previewTickMsg struct {
+	id int
+}
+
+func previewTick(id int) tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg {
+		return previewTickMsg{id: id}
+	})
+}
+
+// totpRemaining returns the number of seconds until the current TOTP code expires
+func totpRemaining(t time.Time) int {
+	return totpPeriod - int(t.Unix()%totpPeriod)
+}
+
+// totpTickMsg is used to refresh the TOTP code of the highlighted session
+type totpTickMsg struct{}
+
+func totpTick() tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg {
+		return totpTickMsg{}
+	})
+}
+
+// totpBadge renders the TOTP code which is valid at the given time, along with a bar of the remaining seconds
+func totpBadge(secret string, t time.Time) string {
+	code, err := core.GetTOTPCode(secret, t)
+	if err != nil {
+		return statusErrorStyle(totpIndicator + " invalid")
+	}
+	if len(code) == 6 {
+		code = code[:3] + " " + code[3:]
+	}
+	remaining := totpRemaining(t)
+	filled := (remaining*totpBarWidth + totpPeriod - 1) / totpPeriod
+	bar := strings.Repeat("▰", filled) + strings.Repeat("▱", totpBarWidth-filled)
+	style := totpStyle
+	if remaining <= 5 {
+		style = totpExpiringStyle
+	}
+	return style.Render(fmt.Sprintf("%s %s %s %2ds", totpIndicator, code, bar, remaining))
+}
+
+func maskPassword(v string) string {
+	if v == "" {
+		return "not set"
+	}
+	return strings.Repeat("•", 8)
+}
+
+func formatRevisionDate(v string) string {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t.Local().Format("2006-01-02 15:04")
+	}
+	return v
+}
+
+// renderPreview renders the details of a session within the given dimensions
+func renderPreview(s *core.CumulocitySession, width int, height int) string {
+	frameW, frameH := previewStyle.GetFrameSize()
+	innerWidth := max(width-frameW, 10)
+	innerHeight := max(height-frameH, 1)
+	style := previewStyle.Width(innerWidth + previewStyle.GetHorizontalPadding())
+
+	if s == nil {
+		return style.Render("No session selected")
+	}
+
+	totp := "not configured"
+	if s.TOTPSecret != "" {
+		totp = fmt.Sprintf("configured (new code in %ds)", totpRemaining(time.Now()))
+	}
+
+	rows := [][2]string{
+		{"Name", s.Name},
+		{"Host", s.Host},
+		{"Tenant", s.Tenant},
+		{"Username", s.Username},
+		{"Password", maskPassword(s.Password)},
+		{"TOTP", totp},
+		{"Mode", s.Mode},
+		{"Login type", s.LoginType},
+		{"Folder", s.FolderName},
+		{"Revised", formatRevisionDate(s.RevisionDate)},
+	}
+
+	valueStyle := lipgloss.NewStyle().Width(max(innerWidth-previewLabelStyle.GetWidth(), 1))
+	lines := make([]string, 0, len(rows)+2)
+	for _, row := range rows {
+		value := row[1]
+		if value == "" {
+			value = "-"
+		}
+		lines = append(lines, lipgloss.JoinHorizontal(lipgloss.Top, previewLabelStyle.Render(row[0]), valueStyle.Render(value)))
+	}
+	if s.Notes != "" {
+		lines = append(lines, "", previewLabelStyle.Render("Notes"), lipgloss.NewStyle().Width(innerWidth).Render(s.Notes))
+	}
+	// Truncate the content rather than the border if there is not enough space
+	lines = strings.Split(strings.Join(lines, "\n"), "\n")
+	if len(lines) > innerHeight {
+		lines = lines[:innerHeight]
+	}
+	return style.Render(strings.Join(lines, "\n"))
+}
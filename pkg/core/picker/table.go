@@ -0,0 +1,284 @@
+package picker
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/reflow/truncate"
+	"github.com/reubenmiller/c8y-session-bitwarden/pkg/core"
+)
+
+const (
+	LayoutDefault = "default"
+	LayoutTable   = "table"
+
+	// tableColumnGap is the number of spaces between two columns
+	tableColumnGap = 2
+
+	// tableColumnMaxWidth is the maximum width of a column (before it is shrunk to fit the window)
+	tableColumnMaxWidth = 40
+)
+
+// Layouts lists the supported picker layouts
+var Layouts = []string{LayoutDefault, LayoutTable}
+
+// tableColumn defines how a column of the table layout is rendered
+type tableColumn struct {
+	Name     string
+	Title    string
+	MinWidth int
+	Value    func(s *core.CumulocitySession) string
+}
+
+var tableColumns = []tableColumn{
+	{Name: "name", Title: "NAME", MinWidth: 8, Value: func(s *core.CumulocitySession) string { return s.Name }},
+	{Name: "host", Title: "HOST", MinWidth: 12, Value: func(s *core.CumulocitySession) string { return s.Host }},
+	{Name: "tenant", Title: "TENANT", MinWidth: 6, Value: func(s *core.CumulocitySession) string { return s.Tenant }},
+	{Name: "user", Title: "USER", MinWidth: 6, Value: func(s *core.CumulocitySession) string { return s.Username }},
+	{Name: "mode", Title: "MODE", MinWidth: 6, Value: func(s *core.CumulocitySession) string {
+		v, _ := core.MarshalSessionType(s.Mode)
+		return v
+	}},
+	{Name: "folder", Title: "FOLDER", MinWidth: 6, Value: func(s *core.CumulocitySession) string { return s.FolderName }},
+	{Name: "organization", Title: "ORGANIZATION", MinWidth: 6, Value: func(s *core.CumulocitySession) string { return s.OrganizationName }},
+	{Name: "loginType", Title: "LOGIN TYPE", MinWidth: 6, Value: func(s *core.CumulocitySession) string { return s.LoginType }},
+}
+
+// DefaultTableColumns are the columns shown in the table layout if no columns are given
+var DefaultTableColumns = []string{"name", "host", "tenant", "user", "mode", "folder"}
+
+// TableColumns returns the names of all the columns which can be used in the table layout
+func TableColumns() []string {
+	names := make([]string, 0, len(tableColumns))
+	for _, c := range tableColumns {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// ValidateLayout checks if the layout and table columns are supported
+func ValidateLayout(layout string, columns []string) error {
+	if layout != "" && !slices.Contains(Layouts, layout) {
+		return fmt.Errorf("invalid layout: %s. allowed values: %s", layout, strings.Join(Layouts, ", "))
+	}
+	_, err := resolveTableColumns(columns)
+	return err
+}
+
+func resolveTableColumns(names []string) ([]tableColumn, error) {
+	if len(names) == 0 {
+		names = DefaultTableColumns
+	}
+	columns := make([]tableColumn, 0, len(names))
+	for _, name := range names {
+		idx := slices.IndexFunc(tableColumns, func(c tableColumn) bool {
+			return strings.EqualFold(c.Name, strings.TrimSpace(name))
+		})
+		if idx == -1 {
+			return nil, fmt.Errorf("unknown table column: %s. allowed values: %s", name, strings.Join(TableColumns(), ", "))
+		}
+		columns = append(columns, tableColumns[idx])
+	}
+	return columns, nil
+}
+
+// tableLayout contains the columns of the table layout and their current widths.
+// It is shared between the model and the delegate so that the widths follow the window size
+type tableLayout struct {
+	columns []tableColumn
+	widths  []int
+
+	// sortColumn is the index of the column the sessions are sorted by (-1 if not sorted)
+	sortColumn int
+	sortDesc   bool
+}
+
+func newTableLayout(names []string) *tableLayout {
+	columns, err := resolveTableColumns(names)
+	if err != nil {
+		columns, _ = resolveTableColumns(nil)
+	}
+	return &tableLayout{
+		columns:    columns,
+		widths:     make([]int, len(columns)),
+		sortColumn: -1,
+	}
+}
+
+// resize calculates the column widths so that the table fits in the given width. Columns are first
+// shrunk (widest first) down to their minimum width, and then hidden (from the right) if there is still not enough space.
+// Hidden columns have a width of 0
+func (t *tableLayout) resize(width int, sessions []*core.CumulocitySession) {
+	for i, c := range t.columns {
+		w := lipgloss.Width(c.Title) + 2 // leave room for the sort indicator
+		for _, s := range sessions {
+			w = max(w, lipgloss.Width(c.Value(s)))
+		}
+		t.widths[i] = min(w, tableColumnMaxWidth)
+	}
+
+	total := func() int {
+		sum := 0
+		for _, w := range t.widths {
+			if w > 0 {
+				sum += w + tableColumnGap
+			}
+		}
+		return sum
+	}
+
+	for total() > width {
+		widest := -1
+		for i, w := range t.widths {
+			if w > t.columns[i].MinWidth && (widest == -1 || w > t.widths[widest]) {
+				widest = i
+			}
+		}
+		if widest == -1 {
+			break
+		}
+		t.widths[widest]--
+	}
+
+	for i := len(t.widths) - 1; i > 0 && total() > width; i-- {
+		t.widths[i] = 0
+	}
+}
+
+// row renders the cells of a row using the current column widths
+func (t *tableLayout) row(cell func(i int, c tableColumn, width int) string) string {
+	cells := make([]string, 0, len(t.columns))
+	for i, c := range t.columns {
+		if t.widths[i] <= 0 {
+			continue
+		}
+		cells = append(cells, cell(i, c, t.widths[i]))
+	}
+	return strings.Join(cells, strings.Repeat(" ", tableColumnGap))
+}
+
+// header returns the column titles including the sort indicator
+func (t *tableLayout) header() string {
+	return t.row(func(i int, c tableColumn, width int) string {
+		title := c.Title
+		if i == t.sortColumn {
+			if t.sortDesc {
+				title += " ▼"
+			} else {
+				title += " ▲"
+			}
+		}
+		return padCell(title, width)
+	})
+}
+
+// nextSortColumn cycles through the visible columns, and back to the original order
+func (t *tableLayout) nextSortColumn() {
+	for {
+		t.sortColumn++
+		if t.sortColumn >= len(t.columns) {
+			t.sortColumn = -1
+			return
+		}
+		if t.widths[t.sortColumn] > 0 {
+			return
+		}
+	}
+}
+
+// sort returns a sorted copy of the sessions
+func (t *tableLayout) sort(sessions []*core.CumulocitySession) []*core.CumulocitySession {
+	if t.sortColumn < 0 || t.sortColumn >= len(t.columns) {
+		return sessions
+	}
+	c := t.columns[t.sortColumn]
+	sorted := slices.Clone(sessions)
+	slices.SortStableFunc(sorted, func(a, b *core.CumulocitySession) int {
+		v := cmp.Compare(strings.ToLower(c.Value(a)), strings.ToLower(c.Value(b)))
+		if t.sortDesc {
+			return -v
+		}
+		return v
+	})
+	return sorted
+}
+
+func padCell(v string, width int) string {
+	if lipgloss.Width(v) > width {
+		v = truncate.StringWithTail(v, uint(width), "…")
+	}
+	return v + strings.Repeat(" ", max(width-lipgloss.Width(v), 0))
+}
+
+// tableDelegate renders each session as a single row of the table layout
+type tableDelegate struct {
+	itemDelegate
+	table *tableLayout
+}
+
+func (d tableDelegate) Height() int  { return 1 }
+func (d tableDelegate) Spacing() int { return 0 }
+
+// Render prints a session as a table row, or a group header
+func (d tableDelegate) Render(w io.Writer, m list.Model, index int, item list.Item) {
+	if m.Width() <= 0 {
+		return
+	}
+
+	isSelected := index == m.Index() && m.FilterState() != list.Filtering
+	cursor, marker := " ", " "
+	if isSelected {
+		cursor = "│"
+	}
+	if i, ok := item.(*core.CumulocitySession); ok {
+		// Show the pinned/hidden marker in place of the padding
+		if v := d.marker(i); v != "" {
+			marker = v
+		}
+	}
+	prefix := cursor + marker
+	if i, ok := item.(*core.CumulocitySession); ok {
+		if checkbox := d.checkbox(i); checkbox != "" {
+			prefix += checkbox + " "
+		}
+	}
+	if isSelected {
+		prefix = tableCursorStyle.Render(prefix)
+	}
+
+	switch i := item.(type) {
+	case *groupHeader:
+		style := groupHeaderStyle.Copy().UnsetPadding()
+		icon := "▼"
+		if i.collapsed {
+			icon = "▶"
+		}
+		fmt.Fprint(w, prefix+style.Render(fmt.Sprintf("%s %s (%d)", icon, i.name, i.count)))
+
+	case *collection:
+		style := tableRowStyle
+		if isSelected {
+			style = tableRowSelectedStyle
+		}
+		text := fmt.Sprintf("▸ %s (%d)", i.label(), i.count)
+		fmt.Fprint(w, prefix+style.Render(padCell(text, max(m.Width()-lipgloss.Width(prefix), 0))))
+
+	case *core.CumulocitySession:
+		rowStyle := tableRowStyle
+		if isSelected {
+			rowStyle = tableRowSelectedStyle
+		}
+		row := d.table.row(func(_ int, c tableColumn, width int) string {
+			if c.Name == "mode" {
+				return modeBadge(i.Mode) + strings.Repeat(" ", max(width-lipgloss.Width(modeBadge(i.Mode)), 0))
+			}
+			return rowStyle.Render(padCell(c.Value(i), width))
+		})
+		fmt.Fprint(w, prefix+row)
+	}
+}
@@ -0,0 +1,322 @@
+package picker
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+	"github.com/reubenmiller/c8y-session-bitwarden/pkg/core"
+)
+
+const (
+	ThemeDefault      = "default"
+	ThemeDark         = "dark"
+	ThemeLight        = "light"
+	ThemeHighContrast = "high-contrast"
+)
+
+// Themes lists the supported theme presets
+var Themes = []string{
+	ThemeDefault,
+	ThemeDark,
+	ThemeLight,
+	ThemeHighContrast,
+}
+
+// Theme contains the colours used by the builtin picker
+type Theme struct {
+	Title           lipgloss.TerminalColor
+	TitleBackground lipgloss.TerminalColor
+	Status          lipgloss.TerminalColor
+	Error           lipgloss.TerminalColor
+	Text            lipgloss.TerminalColor
+	Muted           lipgloss.TerminalColor
+	Subtle          lipgloss.TerminalColor
+	Selection       lipgloss.TerminalColor
+	SelectionBorder lipgloss.TerminalColor
+	BadgeText       lipgloss.TerminalColor
+	Production      lipgloss.TerminalColor
+	Qual            lipgloss.TerminalColor
+	Dev             lipgloss.TerminalColor
+}
+
+// colors returns the colours of the theme by the name used in the config file
+func (t *Theme) colors() map[string]*lipgloss.TerminalColor {
+	return map[string]*lipgloss.TerminalColor{
+		"title":           &t.Title,
+		"titleBackground": &t.TitleBackground,
+		"status":          &t.Status,
+		"error":           &t.Error,
+		"text":            &t.Text,
+		"muted":           &t.Muted,
+		"subtle":          &t.Subtle,
+		"selection":       &t.Selection,
+		"selectionBorder": &t.SelectionBorder,
+		"badgeText":       &t.BadgeText,
+		"production":      &t.Production,
+		"qual":            &t.Qual,
+		"dev":             &t.Dev,
+	}
+}
+
+// ThemeColors returns the names of the theme colours which can be set in the config file
+func ThemeColors() []string {
+	names := make([]string, 0)
+	for name := range (&Theme{}).colors() {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// adaptive returns a colour which depends on the background of the terminal
+func adaptive(light, dark string) lipgloss.AdaptiveColor {
+	return lipgloss.AdaptiveColor{Light: light, Dark: dark}
+}
+
+// themes are the presets. The default theme adapts to the background of the terminal, whereas the
+// dark and light themes can be used if the background can not be detected
+var themes = map[string]func() *Theme{
+	ThemeDefault: func() *Theme {
+		return &Theme{
+			Title:           lipgloss.Color("#FFFDF5"),
+			TitleBackground: lipgloss.Color("#25A065"),
+			Status:          adaptive("#04B575", "#04B575"),
+			Error:           adaptive("#D7263D", "#FF5F5F"),
+			Text:            adaptive("#1A1A1A", "#DDDDDD"),
+			Muted:           adaptive("#909090", "#626262"),
+			Subtle:          adaptive("#A49FA5", "#777777"),
+			Selection:       adaptive("#EE6FF8", "#EE6FF8"),
+			SelectionBorder: adaptive("#F793FF", "#AD58B4"),
+			BadgeText:       lipgloss.Color("#FFFFFF"),
+			Production:      lipgloss.Color("#C62828"),
+			Qual:            lipgloss.Color("#E69500"),
+			Dev:             lipgloss.Color("#2E7D32"),
+		}
+	},
+	ThemeDark: func() *Theme {
+		return &Theme{
+			Title:           lipgloss.Color("#FFFDF5"),
+			TitleBackground: lipgloss.Color("#25A065"),
+			Status:          lipgloss.Color("#04B575"),
+			Error:           lipgloss.Color("#FF5F5F"),
+			Text:            lipgloss.Color("#DDDDDD"),
+			Muted:           lipgloss.Color("#626262"),
+			Subtle:          lipgloss.Color("#777777"),
+			Selection:       lipgloss.Color("#EE6FF8"),
+			SelectionBorder: lipgloss.Color("#AD58B4"),
+			BadgeText:       lipgloss.Color("#FFFFFF"),
+			Production:      lipgloss.Color("#C62828"),
+			Qual:            lipgloss.Color("#E69500"),
+			Dev:             lipgloss.Color("#2E7D32"),
+		}
+	},
+	ThemeLight: func() *Theme {
+		return &Theme{
+			Title:           lipgloss.Color("#FFFFFF"),
+			TitleBackground: lipgloss.Color("#1B7A4B"),
+			Status:          lipgloss.Color("#02794A"),
+			Error:           lipgloss.Color("#B00020"),
+			Text:            lipgloss.Color("#1A1A1A"),
+			Muted:           lipgloss.Color("#6E6E6E"),
+			Subtle:          lipgloss.Color("#857F86"),
+			Selection:       lipgloss.Color("#A224AD"),
+			SelectionBorder: lipgloss.Color("#C94FD3"),
+			BadgeText:       lipgloss.Color("#FFFFFF"),
+			Production:      lipgloss.Color("#B71C1C"),
+			Qual:            lipgloss.Color("#B36B00"),
+			Dev:             lipgloss.Color("#1B5E20"),
+		}
+	},
+	// The high contrast theme only uses the 16 basic ANSI colours, so the colours can be adjusted
+	// using the colour scheme of the terminal
+	ThemeHighContrast: func() *Theme {
+		return &Theme{
+			Title:           lipgloss.Color("0"),
+			TitleBackground: lipgloss.Color("11"),
+			Status:          lipgloss.Color("10"),
+			Error:           lipgloss.Color("9"),
+			Text:            lipgloss.Color("15"),
+			Muted:           lipgloss.Color("7"),
+			Subtle:          lipgloss.Color("7"),
+			Selection:       lipgloss.Color("14"),
+			SelectionBorder: lipgloss.Color("14"),
+			BadgeText:       lipgloss.Color("0"),
+			Production:      lipgloss.Color("9"),
+			Qual:            lipgloss.Color("11"),
+			Dev:             lipgloss.Color("10"),
+		}
+	},
+}
+
+var colorPattern = regexp.MustCompile(`^(#[0-9a-fA-F]{6}|#[0-9a-fA-F]{3}|[0-9]{1,3})$`)
+
+// NewTheme returns the theme preset with the given name (or the default theme if the name is empty),
+// along with any colour overrides, e.g. {"title": "#FFFFFF"}
+func NewTheme(name string, overrides map[string]string) (*Theme, error) {
+	if name == "" {
+		name = ThemeDefault
+	}
+	preset, ok := themes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown theme: %s. allowed values: %s", name, strings.Join(Themes, ", "))
+	}
+	theme := preset()
+	colors := theme.colors()
+	for colorName, value := range overrides {
+		color, ok := colors[colorName]
+		if !ok {
+			return nil, fmt.Errorf("unknown theme colour: %s. allowed values: %s", colorName, strings.Join(ThemeColors(), ", "))
+		}
+		if !colorPattern.MatchString(value) {
+			return nil, fmt.Errorf("invalid colour for %s: %s. expected a hex colour (e.g. #25A065) or an ANSI colour number (0-255)", colorName, value)
+		}
+		*color = lipgloss.Color(value)
+	}
+	return theme, nil
+}
+
+// Styles of the builtin picker. They are set by applyTheme
+var (
+	titleStyle               lipgloss.Style
+	statusMessageStyle       func(strs ...string) string
+	statusErrorStyle         func(strs ...string) string
+	groupHeaderStyle         lipgloss.Style
+	groupHeaderSelectedStyle lipgloss.Style
+	badgeStyle               lipgloss.Style
+	modeBadgeColors          map[string]lipgloss.TerminalColor
+	itemStyles               list.DefaultItemStyles
+	listStyles               list.Styles
+	helpStyles               help.Styles
+	tableCursorStyle         lipgloss.Style
+	tableHeaderStyle         lipgloss.Style
+	tableRowStyle            lipgloss.Style
+	tableRowSelectedStyle    lipgloss.Style
+	totpStyle                lipgloss.Style
+	totpExpiringStyle        lipgloss.Style
+	previewStyle             lipgloss.Style
+	previewLabelStyle        lipgloss.Style
+	formLabelStyle           lipgloss.Style
+	formLabelFocusedStyle    lipgloss.Style
+	formHelpStyle            lipgloss.Style
+)
+
+func init() {
+	applyTheme(themes[ThemeDefault]())
+}
+
+// applyTheme sets the styles of the picker using the colours of the theme
+func applyTheme(t *Theme) {
+	titleStyle = lipgloss.NewStyle().
+		Foreground(t.Title).
+		Background(t.TitleBackground).
+		Padding(0, 1)
+
+	statusMessageStyle = lipgloss.NewStyle().Foreground(t.Status).Render
+	statusErrorStyle = lipgloss.NewStyle().Foreground(t.Error).Render
+
+	groupHeaderStyle = lipgloss.NewStyle().
+		Bold(true).
+		Foreground(t.Text).
+		Padding(0, 0, 0, 2)
+
+	groupHeaderSelectedStyle = groupHeaderStyle.Copy().
+		Border(lipgloss.NormalBorder(), false, false, false, true).
+		BorderForeground(t.SelectionBorder).
+		Foreground(t.Selection).
+		Padding(0, 0, 0, 1)
+
+	badgeStyle = lipgloss.NewStyle().
+		Bold(true).
+		Foreground(t.BadgeText).
+		Width(6).
+		Align(lipgloss.Center)
+
+	modeBadgeColors = map[string]lipgloss.TerminalColor{
+		core.TypeProduction: t.Production,
+		core.TypeQual:       t.Qual,
+		core.TypeDev:        t.Dev,
+	}
+
+	itemStyles = list.NewDefaultItemStyles()
+	itemStyles.NormalTitle = itemStyles.NormalTitle.Copy().Foreground(t.Text)
+	itemStyles.NormalDesc = itemStyles.NormalDesc.Copy().Foreground(t.Subtle)
+	itemStyles.SelectedTitle = itemStyles.SelectedTitle.Copy().Foreground(t.Selection).BorderForeground(t.SelectionBorder)
+	itemStyles.SelectedDesc = itemStyles.SelectedDesc.Copy().Foreground(t.SelectionBorder).BorderForeground(t.SelectionBorder)
+	itemStyles.DimmedTitle = itemStyles.DimmedTitle.Copy().Foreground(t.Subtle)
+	itemStyles.DimmedDesc = itemStyles.DimmedDesc.Copy().Foreground(t.Muted)
+
+	listStyles = list.DefaultStyles()
+	listStyles.Title = titleStyle
+	listStyles.FilterPrompt = listStyles.FilterPrompt.Copy().Foreground(t.Status)
+	listStyles.FilterCursor = listStyles.FilterCursor.Copy().Foreground(t.Selection)
+	listStyles.StatusBar = listStyles.StatusBar.Copy().Foreground(t.Subtle)
+	listStyles.StatusEmpty = listStyles.StatusEmpty.Copy().Foreground(t.Muted)
+	listStyles.StatusBarActiveFilter = listStyles.StatusBarActiveFilter.Copy().Foreground(t.Text)
+	listStyles.StatusBarFilterCount = listStyles.StatusBarFilterCount.Copy().Foreground(t.Muted)
+	listStyles.NoItems = listStyles.NoItems.Copy().Foreground(t.Muted)
+	listStyles.ArabicPagination = listStyles.ArabicPagination.Copy().Foreground(t.Muted)
+	listStyles.ActivePaginationDot = listStyles.ActivePaginationDot.Copy().Foreground(t.Subtle)
+	listStyles.InactivePaginationDot = listStyles.InactivePaginationDot.Copy().Foreground(t.Muted)
+	listStyles.DividerDot = listStyles.DividerDot.Copy().Foreground(t.Muted)
+
+	// The keys are slightly brighter than their descriptions
+	helpKeyStyle := lipgloss.NewStyle().Foreground(t.Subtle)
+	helpDescStyle := lipgloss.NewStyle().Foreground(t.Muted)
+	helpStyles = help.Styles{
+		ShortKey:       helpKeyStyle,
+		ShortDesc:      helpDescStyle,
+		ShortSeparator: helpDescStyle,
+		Ellipsis:       helpDescStyle,
+		FullKey:        helpKeyStyle,
+		FullDesc:       helpDescStyle,
+		FullSeparator:  helpDescStyle,
+	}
+
+	tableCursorStyle = lipgloss.NewStyle().Foreground(t.SelectionBorder)
+	tableHeaderStyle = lipgloss.NewStyle().Bold(true).Foreground(t.Muted)
+	tableRowStyle = lipgloss.NewStyle().Foreground(t.Text)
+	tableRowSelectedStyle = lipgloss.NewStyle().Foreground(t.Selection)
+
+	totpStyle = lipgloss.NewStyle().Foreground(t.Status)
+	totpExpiringStyle = lipgloss.NewStyle().Foreground(t.Error)
+
+	previewStyle = lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(t.Subtle).
+		Padding(0, 1)
+
+	previewLabelStyle = lipgloss.NewStyle().
+		Foreground(t.Muted).
+		Width(12)
+
+	formLabelStyle = lipgloss.NewStyle().
+		Width(12).
+		Foreground(t.Muted)
+	formLabelFocusedStyle = formLabelStyle.Copy().Foreground(t.Selection)
+	formHelpStyle = lipgloss.NewStyle().Foreground(t.Muted)
+}
+
+// setListStyles sets the styles of the list. The styles which the list copies into its components
+// when it is created are set as well
+func setListStyles(l *list.Model) {
+	l.Styles = listStyles
+	l.Help.Styles = helpStyles
+	l.FilterInput.PromptStyle = listStyles.FilterPrompt
+	l.FilterInput.Cursor.Style = listStyles.FilterCursor
+	l.Paginator.ActiveDot = listStyles.ActivePaginationDot.String()
+	l.Paginator.InactiveDot = listStyles.InactivePaginationDot.String()
+}
+
+// detectColors detects the colour profile and background of the terminal the picker is rendered to,
+// rather than stdout, as stdout is usually redirected (e.g. eval "$(c8y-session-bitwarden list)").
+// The detection is done when the first style is rendered, and NO_COLOR disables the colours
+func detectColors(w io.Writer) {
+	lipgloss.DefaultRenderer().SetOutput(termenv.NewOutput(w))
+}
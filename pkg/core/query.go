@@ -0,0 +1,500 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// queryFields maps the field qualifiers which can be used in a query to the session values
+var queryFields = map[string]func(s *CumulocitySession) string{
+	"host":         func(s *CumulocitySession) string { return s.Host },
+	"tenant":       func(s *CumulocitySession) string { return s.Tenant },
+	"mode":         func(s *CumulocitySession) string { return s.Mode },
+	"user":         func(s *CumulocitySession) string { return s.Username },
+	"username":     func(s *CumulocitySession) string { return s.Username },
+	"folder":       func(s *CumulocitySession) string { return s.FolderName },
+	"name":         func(s *CumulocitySession) string { return s.Name },
+	"uri":          func(s *CumulocitySession) string { return s.SessionURI },
+	"org":          func(s *CumulocitySession) string { return s.OrganizationName },
+	"organization": func(s *CumulocitySession) string { return s.OrganizationName },
+	"logintype":    func(s *CumulocitySession) string { return s.LoginType },
+}
+
+// QueryFields returns the names of the field qualifiers which can be used in a query
+func QueryFields() []string {
+	names := make([]string, 0, len(queryFields))
+	for name := range queryFields {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// defaultFieldValues returns the values which are matched by terms without a field qualifier
+func defaultFieldValues(s *CumulocitySession) []string {
+	return []string{s.Username, s.Host, s.Name, s.Tenant, s.Mode, s.FolderName, s.OrganizationName, sessionRef(s)}
+}
+
+// sessionRef returns the session uri without its scheme, e.g. the item id of bitwarden://<id>, as
+// the scheme is the same for all sessions
+func sessionRef(s *CumulocitySession) string {
+	if _, ref, found := strings.Cut(s.SessionURI, "://"); found {
+		return ref
+	}
+	return s.SessionURI
+}
+
+// closestField returns the field qualifier which the given name is most likely a typo of, e.g. tenat or usr
+func closestField(name string) (string, bool) {
+	typos := maxTypos(name)
+	if len([]rune(name)) >= 3 {
+		typos = max(typos, 1)
+	}
+	closest, best := "", typos+1
+	for _, field := range QueryFields() {
+		if d := editDistance(name, field); d < best {
+			closest, best = field, d
+		}
+	}
+	return closest, closest != ""
+}
+
+// QueryError is returned when a query can not be parsed
+type QueryError struct {
+	Query    string
+	Position int
+	Message  string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("invalid query at position %d: %s\n  %s\n  %s^", e.Position+1, e.Message, e.Query, strings.Repeat(" ", e.Position))
+}
+
+type tokenKind int
+
+const (
+	tokenTerm tokenKind = iota
+	tokenNot
+	tokenOr
+	tokenLParen
+	tokenRParen
+)
+
+type token struct {
+	kind  tokenKind
+	pos   int
+	field string
+	value string
+	regex *regexp.Regexp
+	plain bool
+}
+
+// queryNode is a node of the parsed query
+type queryNode interface {
+	match(s *CumulocitySession) bool
+}
+
+type andNode []queryNode
+
+func (n andNode) match(s *CumulocitySession) bool {
+	for _, child := range n {
+		if !child.match(s) {
+			return false
+		}
+	}
+	return true
+}
+
+type orNode []queryNode
+
+func (n orNode) match(s *CumulocitySession) bool {
+	for _, child := range n {
+		if child.match(s) {
+			return true
+		}
+	}
+	return false
+}
+
+type notNode struct {
+	child queryNode
+}
+
+func (n notNode) match(s *CumulocitySession) bool {
+	return !n.child.match(s)
+}
+
+type termNode struct {
+	field string
+	value string
+	regex *regexp.Regexp
+}
+
+func (n termNode) match(s *CumulocitySession) bool {
+	var values []string
+	if n.field == "" {
+		values = defaultFieldValues(s)
+	} else {
+		values = []string{queryFields[n.field](s)}
+	}
+	for _, v := range values {
+		if n.regex != nil {
+			if n.regex.MatchString(v) {
+				return true
+			}
+		} else if strings.Contains(strings.ToLower(v), n.value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Query is a parsed search query. The query language supports:
+//
+//   - terms which are matched (case-insensitive) against the session, e.g. example.com
+//   - field qualifiers, e.g. host:example.com, tenant:t12345, mode:prod, user:admin, folder:c8y.
+//     Words which are not a field (e.g. localhost:8080) are used as a term
+//   - negation, e.g. -mode:prod
+//   - OR groups, e.g. mode:dev OR mode:qual, (tenant:t1 | tenant:t2)
+//   - quoted phrases, e.g. name:"my tenant"
+//   - regular expressions, e.g. /^t\d+$/, host:/eu-latest/
+//
+// Terms are ANDed together, and AND has a higher precedence than OR
+type Query struct {
+	// Fuzzy enables typo-tolerant matching when ranking sessions (see Rank)
+	Fuzzy bool
+
+	input string
+	root  queryNode
+
+	// warnings are problems which did not prevent the query from being parsed, e.g. a likely typo of a field
+	warnings []*QueryError
+
+	// searchTerm is a plain term which all matches must contain
+	searchTerm string
+}
+
+// ParseQuery parses a search query
+func ParseQuery(input string) (*Query, error) {
+	tokens, warnings, err := tokenizeQuery(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{input: input, tokens: tokens}
+	q := &Query{input: input, root: andNode{}, warnings: warnings}
+	if len(tokens) == 0 {
+		return q, nil
+	}
+	q.root, err = p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(tokens) {
+		return nil, p.errorf(tokens[p.pos].pos, "unexpected ')'")
+	}
+
+	// Only use a top level plain term as search term, as it must be contained in all matches
+	for _, t := range tokens {
+		if t.kind == tokenOr || t.kind == tokenNot || t.kind == tokenLParen {
+			return q, nil
+		}
+	}
+	for _, t := range tokens {
+		if t.kind == tokenTerm && t.plain {
+			q.searchTerm = t.value
+			break
+		}
+	}
+	return q, nil
+}
+
+// ParseQueryTerms parses a query from multiple terms, e.g. command line arguments. An argument
+// containing whitespace is treated as a phrase (as the shell already removed the quotes), unless
+// it is a query itself, e.g. 'host:eu-latest -mode:prod'
+func ParseQueryTerms(terms ...string) (*Query, error) {
+	parts := make([]string, 0, len(terms))
+	for _, term := range terms {
+		if strings.ContainsFunc(term, unicode.IsSpace) {
+			term = quoteArgument(term)
+		}
+		parts = append(parts, term)
+	}
+	return ParseQuery(strings.Join(parts, " "))
+}
+
+// quoteArgument quotes an argument containing whitespace as a phrase if it does not contain any
+// operators or is not a valid query. A field qualifier followed by plain text is kept, e.g. name:my tenant
+func quoteArgument(term string) string {
+	field, value, found := strings.Cut(term, ":")
+	if found && queryFields[strings.ToLower(field)] != nil && !hasOperators(value) {
+		return field + ":" + quotePhrase(value)
+	}
+	if hasOperators(term) {
+		if _, err := ParseQuery(term); err == nil {
+			return term
+		}
+	}
+	return quotePhrase(term)
+}
+
+// hasOperators returns true if the text contains any operators of the query language, e.g. OR, a negated
+// term, a field qualifier, a group, a phrase or a regular expression
+func hasOperators(v string) bool {
+	if strings.ContainsAny(v, `|"/()`) {
+		return true
+	}
+	for _, word := range strings.Fields(v) {
+		if word == "OR" || (len(word) > 1 && word[0] == '-') {
+			return true
+		}
+		if field, _, found := strings.Cut(word, ":"); found && queryFields[strings.ToLower(field)] != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// quotePhrase quotes the text as a phrase of the query language
+func quotePhrase(v string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+}
+
+// Match checks if the session matches the query
+func (q *Query) Match(s *CumulocitySession) bool {
+	return q.root.match(s)
+}
+
+// SearchTerm returns a plain term (without field qualifiers, negation or regular expressions)
+// which all matching sessions must contain. It can be used to pre-filter the sessions on the server side.
+// An empty string is returned if there is no such term
+func (q *Query) SearchTerm() string {
+	return q.searchTerm
+}
+
+// Warnings returns the problems which did not prevent the query from being parsed, e.g. a word
+// which looks like a typo of a field qualifier (tenat:t12345) is matched as text
+func (q *Query) Warnings() []*QueryError {
+	return q.warnings
+}
+
+func (q *Query) String() string {
+	return q.input
+}
+
+func tokenizeQuery(input string) ([]token, []*QueryError, error) {
+	tokens := make([]token, 0)
+	warnings := make([]*QueryError, 0)
+	runes := []rune(input)
+	errorf := func(pos int, format string, args ...any) error {
+		return &QueryError{Query: input, Position: pos, Message: fmt.Sprintf(format, args...)}
+	}
+
+	i := 0
+	for i < len(runes) {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+			continue
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLParen, pos: i})
+			i++
+			continue
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRParen, pos: i})
+			i++
+			continue
+		case c == '|':
+			tokens = append(tokens, token{kind: tokenOr, pos: i})
+			i++
+			continue
+		case c == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]):
+			tokens = append(tokens, token{kind: tokenNot, pos: i})
+			i++
+			continue
+		}
+
+		// Term, with an optional field qualifier
+		start := i
+		t := token{kind: tokenTerm, pos: start}
+		j := i
+		for j < len(runes) && (unicode.IsLetter(runes[j]) || runes[j] == '_') {
+			j++
+		}
+		if j > i && j < len(runes) && runes[j] == ':' {
+			field := strings.ToLower(string(runes[i:j]))
+			if _, ok := queryFields[field]; ok {
+				t.field = field
+				i = j + 1
+			} else if suggestion, ok := closestField(field); ok && !strings.HasPrefix(string(runes[j:]), "://") {
+				// Other words are used as a literal term, e.g. localhost:8080 or https://example.com
+				warnings = append(warnings, &QueryError{
+					Query:    input,
+					Position: start,
+					Message:  fmt.Sprintf("unknown field %q is matched as text. did you mean %q?", field, suggestion),
+				})
+			}
+		}
+
+		switch {
+		case i < len(runes) && runes[i] == '"':
+			end := i + 1
+			value := strings.Builder{}
+			for end < len(runes) && runes[end] != '"' {
+				if runes[end] == '\\' && end+1 < len(runes) {
+					end++
+				}
+				value.WriteRune(runes[end])
+				end++
+			}
+			if end >= len(runes) {
+				return nil, nil, errorf(i, "missing closing quote")
+			}
+			t.value = strings.ToLower(value.String())
+			i = end + 1
+
+		case i < len(runes) && runes[i] == '/':
+			end := i + 1
+			for end < len(runes) && runes[end] != '/' {
+				if runes[end] == '\\' && end+1 < len(runes) {
+					end++
+				}
+				end++
+			}
+			if end >= len(runes) {
+				return nil, nil, errorf(i, "missing closing '/' of regular expression")
+			}
+			pattern := strings.ReplaceAll(string(runes[i+1:end]), `\/`, "/")
+			r, err := regexp.Compile("(?i)" + pattern)
+			if err != nil {
+				return nil, nil, errorf(i, "invalid regular expression. %s", err)
+			}
+			t.regex = r
+			t.value = pattern
+			i = end + 1
+
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && runes[end] != ')' {
+				end++
+			}
+			value := string(runes[i:end])
+			if t.field == "" && value == "OR" {
+				tokens = append(tokens, token{kind: tokenOr, pos: start})
+				i = end
+				continue
+			}
+			if value == "" {
+				return nil, nil, errorf(start, "missing value for field %q", t.field)
+			}
+			t.value = strings.ToLower(value)
+			t.plain = t.field == ""
+			i = end
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, warnings, nil
+}
+
+type queryParser struct {
+	input  string
+	tokens []token
+	pos    int
+}
+
+func (p *queryParser) errorf(pos int, format string, args ...any) error {
+	return &QueryError{Query: p.input, Position: pos, Message: fmt.Sprintf(format, args...)}
+}
+
+func (p *queryParser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+// parseOr parses: and (OR and)*
+func (p *queryParser) parseOr() (queryNode, error) {
+	if t, ok := p.peek(); ok && t.kind == tokenOr {
+		return nil, p.errorf(t.pos, "OR must be between two terms")
+	}
+	nodes := orNode{}
+	for {
+		node, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+
+		t, ok := p.peek()
+		if !ok || t.kind != tokenOr {
+			break
+		}
+		p.pos++
+		if next, ok := p.peek(); !ok || next.kind == tokenOr || next.kind == tokenRParen {
+			return nil, p.errorf(t.pos, "OR must be between two terms")
+		}
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+// parseAnd parses: unary+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	nodes := andNode{}
+	for {
+		t, ok := p.peek()
+		if !ok || t.kind == tokenOr || t.kind == tokenRParen {
+			break
+		}
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+// parseUnary parses: '-' unary | '(' or ')' | term
+func (p *queryParser) parseUnary() (queryNode, error) {
+	t, _ := p.peek()
+	p.pos++
+	switch t.kind {
+	case tokenNot:
+		next, ok := p.peek()
+		if !ok || next.kind == tokenOr || next.kind == tokenRParen {
+			return nil, p.errorf(t.pos, "'-' must be followed by a term or group")
+		}
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{child: child}, nil
+
+	case tokenLParen:
+		if next, ok := p.peek(); ok && next.kind == tokenRParen {
+			return nil, p.errorf(t.pos, "empty group")
+		}
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if next, ok := p.peek(); !ok || next.kind != tokenRParen {
+			return nil, p.errorf(t.pos, "missing closing ')'")
+		}
+		p.pos++
+		return node, nil
+
+	default:
+		return termNode{field: t.field, value: t.value, regex: t.regex}, nil
+	}
+}
@@ -0,0 +1,206 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var testSessions = []*CumulocitySession{
+	{
+		SessionURI: "bitwarden://1111",
+		Name:       "customer a",
+		Host:       "https://customer-a.eu-latest.cumulocity.com",
+		Username:   "admin",
+		Tenant:     "t100",
+		Mode:       "prod",
+		FolderName: "c8y",
+	},
+	{
+		SessionURI: "bitwarden://2222",
+		Name:       "local dev",
+		Host:       "http://localhost:8080",
+		Username:   "dev",
+		Tenant:     "t200",
+		Mode:       "dev",
+		FolderName: "local",
+	},
+	{
+		SessionURI:       "bitwarden://3333",
+		Name:             "qual",
+		Host:             "https://qual.example.com",
+		Username:         "ci-bot",
+		Tenant:           "t300",
+		Mode:             "qual",
+		OrganizationName: "Acme",
+	},
+}
+
+// matchingNames returns the names of the test sessions which match the query
+func matchingNames(q *Query) string {
+	names := make([]string, 0)
+	for _, s := range testSessions {
+		if q.Match(s) {
+			names = append(names, s.Name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "", want: "customer a,local dev,qual"},
+		{query: "customer", want: "customer a"},
+		{query: "CUSTOMER", want: "customer a"},
+		{query: "mode:dev OR mode:qual", want: "local dev,qual"},
+		{query: "mode:dev | mode:qual", want: "local dev,qual"},
+		{query: "-mode:prod", want: "local dev,qual"},
+		{query: "-(mode:dev OR mode:qual)", want: "customer a"},
+		{query: "(tenant:t100 | tenant:t300) user:admin", want: "customer a"},
+		{query: `name:"local dev"`, want: "local dev"},
+		{query: `"customer a"`, want: "customer a"},
+		{query: `tenant:/^t[12]00$/`, want: "customer a,local dev"},
+		{query: `host:/eu-latest/`, want: "customer a"},
+		{query: "localhost:8080", want: "local dev"},
+		{query: "https://qual.example.com", want: "qual"},
+		{query: "folder:local", want: "local dev"},
+		{query: "org:acme", want: "qual"},
+		{query: "acme", want: "qual"},
+		{query: "2222", want: "local dev"},
+
+		// Terms must not match the labels or scheme used in the description of the session
+		{query: "user", want: ""},
+		{query: "name", want: ""},
+		{query: "tenant", want: ""},
+		{query: "bitwarden", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got := matchingNames(q); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		query    string
+		position int
+		message  string
+	}{
+		{query: `name:"customer`, position: 5, message: "missing closing quote"},
+		{query: `host:/eu-latest`, position: 5, message: "missing closing '/'"},
+		{query: `/[a-/`, position: 0, message: "invalid regular expression"},
+		{query: `(mode:dev`, position: 0, message: "missing closing ')'"},
+		{query: `mode:dev)`, position: 8, message: "unexpected ')'"},
+		{query: `()`, position: 0, message: "empty group"},
+		{query: `OR mode:dev`, position: 0, message: "OR must be between two terms"},
+		{query: `mode:dev OR`, position: 9, message: "OR must be between two terms"},
+		{query: `tenant:`, position: 0, message: "missing value for field"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := ParseQuery(tt.query)
+			queryErr := &QueryError{}
+			if !errors.As(err, &queryErr) {
+				t.Fatalf("expected a QueryError, got %v", err)
+			}
+			if queryErr.Position != tt.position {
+				t.Errorf("got position %d, want %d", queryErr.Position, tt.position)
+			}
+			if !strings.Contains(queryErr.Message, tt.message) {
+				t.Errorf("got message %q, want it to contain %q", queryErr.Message, tt.message)
+			}
+		})
+	}
+}
+
+func TestParseQueryWarnings(t *testing.T) {
+	tests := []struct {
+		query    string
+		want     string
+		position int
+		message  string
+	}{
+		{query: `mode:dev tenat:t100`, want: "", position: 9, message: `did you mean "tenant"?`},
+		{query: `usr:admin`, want: "", position: 0, message: `did you mean "user"?`},
+		{query: `node:1`, want: "", position: 0, message: `did you mean "mode"?`},
+		{query: `localhost:8080`, want: "local dev", position: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got := matchingNames(q); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			warnings := q.Warnings()
+			if tt.position < 0 {
+				if len(warnings) > 0 {
+					t.Errorf("unexpected warnings: %v", warnings)
+				}
+				return
+			}
+			if len(warnings) != 1 {
+				t.Fatalf("got %d warnings, want 1", len(warnings))
+			}
+			if warnings[0].Position != tt.position {
+				t.Errorf("got position %d, want %d", warnings[0].Position, tt.position)
+			}
+			if !strings.Contains(warnings[0].Message, tt.message) {
+				t.Errorf("got message %q, want it to contain %q", warnings[0].Message, tt.message)
+			}
+		})
+	}
+}
+
+func TestParseQueryTerms(t *testing.T) {
+	tests := []struct {
+		terms      []string
+		want       string
+		searchTerm string
+	}{
+		{terms: []string{"customer a"}, want: "customer a", searchTerm: ""},
+		{terms: []string{"name:local dev"}, want: "local dev", searchTerm: ""},
+		{terms: []string{"t", "-mode:prod"}, want: "local dev,qual", searchTerm: ""},
+		{terms: []string{"localhost:8080"}, want: "local dev", searchTerm: "localhost:8080"},
+		{terms: []string{"mode:dev", "OR", "mode:qual"}, want: "local dev,qual", searchTerm: ""},
+
+		// Queries passed as a single argument, e.g. the README examples
+		{terms: []string{"host:eu-latest -mode:prod"}, want: "", searchTerm: ""},
+		{terms: []string{"host:eu-latest -mode:dev"}, want: "customer a", searchTerm: ""},
+		{terms: []string{"mode:dev | mode:prod"}, want: "customer a,local dev", searchTerm: ""},
+		{terms: []string{"mode:prod -name:dev"}, want: "customer a", searchTerm: ""},
+		{terms: []string{"mode:dev OR mode:qual"}, want: "local dev,qual", searchTerm: ""},
+		{terms: []string{"(tenant:t100 | tenant:t300) user:admin"}, want: "customer a", searchTerm: ""},
+		{terms: []string{`name:"customer a"`}, want: "customer a", searchTerm: ""},
+		{terms: []string{"local dev", "-mode:prod"}, want: "local dev", searchTerm: ""},
+
+		// Invalid queries are matched as a phrase
+		{terms: []string{"mode:dev OR"}, want: "", searchTerm: ""},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.terms, " "), func(t *testing.T) {
+			q, err := ParseQueryTerms(tt.terms...)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got := matchingNames(q); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if got := q.SearchTerm(); got != tt.searchTerm {
+				t.Errorf("got search term %q, want %q", got, tt.searchTerm)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package core
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Scores of a term depending on which field it matched. A higher score is more relevant
+const (
+	ScoreHostExact     = 100
+	ScoreTenantExact   = 90
+	ScoreHostPrefix    = 80
+	ScoreNameExact     = 70
+	ScoreName          = 60
+	ScoreHost          = 55
+	ScoreTenant        = 50
+	ScoreUsernameExact = 45
+	ScoreUsername      = 40
+	ScoreField         = 30
+	ScoreDescription   = 20
+	ScoreOther         = 10
+
+	// fuzzyPenalty is subtracted from the score for each typo of a fuzzy match
+	fuzzyPenalty = 10
+
+	// ClearMatchMargin is the minimum score difference (per term) between the best and
+	// the second best match for the best match to be considered a clear winner
+	ClearMatchMargin = 30
+)
+
+// normalizeHost removes the scheme and trailing slash so that hosts can be compared
+func normalizeHost(host string) string {
+	host = strings.ToLower(host)
+	host = strings.TrimPrefix(host, "https://")
+	host = strings.TrimPrefix(host, "http://")
+	return strings.TrimSuffix(host, "/")
+}
+
+// score returns the relevance score of the term based on the most relevant field it matches.
+// A score of 0 means that the term does not match
+func (n termNode) score(s *CumulocitySession) int {
+	contains := func(v string) bool {
+		if n.regex != nil {
+			return n.regex.MatchString(v)
+		}
+		return strings.Contains(strings.ToLower(v), n.value)
+	}
+	equals := func(v string) bool {
+		return n.regex == nil && strings.ToLower(v) == n.value
+	}
+
+	best := 0
+	check := func(score int, ok bool) {
+		if ok && score > best {
+			best = score
+		}
+	}
+
+	host := normalizeHost(s.Host)
+	value := normalizeHost(n.value)
+	switch n.field {
+	case "", "host":
+		check(ScoreHostExact, n.regex == nil && host == value)
+		check(ScoreHostPrefix, n.regex == nil && value != "" && strings.HasPrefix(host, value))
+		check(ScoreHost, contains(s.Host))
+	}
+	switch n.field {
+	case "", "tenant":
+		check(ScoreTenantExact, equals(s.Tenant))
+		check(ScoreTenant, contains(s.Tenant))
+	}
+	switch n.field {
+	case "", "name":
+		check(ScoreNameExact, equals(s.Name))
+		check(ScoreName, contains(s.Name))
+	}
+	switch n.field {
+	case "", "user", "username":
+		check(ScoreUsernameExact, equals(s.Username))
+		check(ScoreUsername, contains(s.Username))
+	}
+	switch n.field {
+	case "":
+		check(ScoreDescription, contains(s.Mode) || contains(s.FolderName) || contains(s.OrganizationName))
+		check(ScoreOther, contains(sessionRef(s)))
+	case "host", "tenant", "name", "user", "username":
+	default:
+		check(ScoreField, n.match(s))
+	}
+	return best
+}
+
+// fuzzyScore returns the score of a typo-tolerant match of the term against the words of
+// the host, tenant, name and username. A score of 0 means that there is no fuzzy match
+func (n termNode) fuzzyScore(s *CumulocitySession) int {
+	if n.regex != nil {
+		return 0
+	}
+	typos := maxTypos(n.value)
+	if typos == 0 {
+		return 0
+	}
+
+	fields := []struct {
+		name  string
+		score int
+		value string
+	}{
+		{"host", ScoreHost, s.Host},
+		{"tenant", ScoreTenant, s.Tenant},
+		{"name", ScoreName, s.Name},
+		{"user", ScoreUsername, s.Username},
+	}
+	best := 0
+	for _, f := range fields {
+		if n.field != "" && n.field != f.name && !(n.field == "username" && f.name == "user") {
+			continue
+		}
+		words := strings.FieldsFunc(strings.ToLower(f.value), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, word := range words {
+			if d := editDistance(n.value, word); d <= typos {
+				best = max(best, f.score/2-d*fuzzyPenalty)
+			}
+		}
+	}
+	return max(best, 0)
+}
+
+// maxTypos returns the number of typos which are tolerated in a word, depending on its length
+func maxTypos(v string) int {
+	switch l := len([]rune(v)); {
+	case l >= 8:
+		return 2
+	case l >= 4:
+		return 1
+	}
+	return 0
+}
+
+// rank returns the relevance score of the session and whether it matches
+func rank(node queryNode, s *CumulocitySession, fuzzy bool) (int, bool) {
+	switch n := node.(type) {
+	case andNode:
+		total := 0
+		for _, child := range n {
+			score, ok := rank(child, s, fuzzy)
+			if !ok {
+				return 0, false
+			}
+			total += score
+		}
+		return total, true
+	case orNode:
+		best, found := 0, false
+		for _, child := range n {
+			if score, ok := rank(child, s, fuzzy); ok {
+				best, found = max(best, score), true
+			}
+		}
+		return best, found
+	case notNode:
+		return 0, !n.child.match(s)
+	case termNode:
+		if score := n.score(s); score > 0 {
+			return score, true
+		}
+		if fuzzy {
+			if score := n.fuzzyScore(s); score > 0 {
+				return score, true
+			}
+		}
+		return 0, false
+	}
+	return 0, false
+}
+
+// Rank returns the relevance score of the session and whether it matches the query.
+// If fuzzy matching is enabled on the query, then terms with typos also match (with a lower score)
+func (q *Query) Rank(s *CumulocitySession) (int, bool) {
+	return rank(q.root, s, q.Fuzzy)
+}
+
+// termCount returns the number of positive terms, and is used to normalize scores
+func termCount(node queryNode) int {
+	switch n := node.(type) {
+	case andNode:
+		total := 0
+		for _, child := range n {
+			total += termCount(child)
+		}
+		return total
+	case orNode:
+		total := 0
+		for _, child := range n {
+			total = max(total, termCount(child))
+		}
+		return total
+	case termNode:
+		return 1
+	}
+	return 0
+}
+
+// RankedSession is a session along with its relevance score
+type RankedSession struct {
+	Session *CumulocitySession
+	Score   int
+}
+
+// RankSessions returns the sessions matching the query sorted by their relevance (most relevant first).
+// Sessions with the same score keep their original order
+func RankSessions(q *Query, sessions []*CumulocitySession) []RankedSession {
+	ranked := make([]RankedSession, 0, len(sessions))
+	for _, s := range sessions {
+		if score, ok := q.Rank(s); ok {
+			ranked = append(ranked, RankedSession{Session: s, Score: score})
+		}
+	}
+	slices.SortStableFunc(ranked, func(a, b RankedSession) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+	return ranked
+}
+
+// BestMatch returns the most relevant session if it is clearly better than all other sessions, e.g.
+// an exact host or tenant match where the other sessions only match the name or description
+func BestMatch(q *Query, sessions []*CumulocitySession) (*CumulocitySession, bool) {
+	ranked := RankSessions(q, sessions)
+	switch len(ranked) {
+	case 0:
+		return nil, false
+	case 1:
+		return ranked[0].Session, true
+	}
+	terms := termCount(q.root)
+	if terms == 0 {
+		return nil, false
+	}
+	if (ranked[0].Score-ranked[1].Score)/terms >= ClearMatchMargin {
+		return ranked[0].Session, true
+	}
+	return nil, false
+}
+
+// editDistance returns the number of edits (insertions, deletions, substitutions and transpositions
+// of adjacent characters) required to change one string into the other
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
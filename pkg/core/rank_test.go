@@ -0,0 +1,210 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRank(t *testing.T) {
+	s := &CumulocitySession{
+		SessionURI:       "bitwarden://1111",
+		Name:             "customer a",
+		Host:             "https://customer-a.eu-latest.cumulocity.com/",
+		Username:         "admin",
+		Tenant:           "t100",
+		Mode:             "prod",
+		FolderName:       "c8y",
+		OrganizationName: "Acme",
+	}
+	tests := []struct {
+		query string
+		fuzzy bool
+		score int
+		ok    bool
+	}{
+		{query: "customer-a.eu-latest.cumulocity.com", score: ScoreHostExact, ok: true},
+		{query: "https://customer-a.eu-latest.cumulocity.com", score: ScoreHostExact, ok: true},
+		{query: "t100", score: ScoreTenantExact, ok: true},
+		{query: "customer-a", score: ScoreHostPrefix, ok: true},
+		{query: `"customer a"`, score: ScoreNameExact, ok: true},
+		{query: "customer", score: ScoreHostPrefix, ok: true},
+		{query: "name:customer", score: ScoreName, ok: true},
+		{query: "cumulocity", score: ScoreHost, ok: true},
+		{query: "t10", score: ScoreTenant, ok: true},
+		{query: "admin", score: ScoreUsernameExact, ok: true},
+		{query: "adm", score: ScoreUsername, ok: true},
+		{query: "acme", score: ScoreDescription, ok: true},
+		{query: "c8y", score: ScoreDescription, ok: true},
+		{query: "1111", score: ScoreOther, ok: true},
+		{query: "folder:c8y", score: ScoreField, ok: true},
+		{query: "t100 admin", score: ScoreTenantExact + ScoreUsernameExact, ok: true},
+		{query: "t100 | admin", score: ScoreTenantExact, ok: true},
+		{query: "-mode:dev", score: 0, ok: true},
+		{query: "bitwarden", ok: false},
+		{query: "custmer", ok: false},
+
+		// Fuzzy matches have a lower score than any exact match
+		{query: "custmer", fuzzy: true, score: ScoreName/2 - fuzzyPenalty, ok: true},
+		{query: "name:custmer", fuzzy: true, score: ScoreName/2 - fuzzyPenalty, ok: true},
+		{query: "tenant:custmer", fuzzy: true, ok: false},
+		{query: "adm1n", fuzzy: true, score: ScoreUsername/2 - fuzzyPenalty, ok: true},
+		{query: "cusotmer", fuzzy: true, score: ScoreName/2 - fuzzyPenalty, ok: true},
+		{query: "cxstxmer", fuzzy: true, score: ScoreName/2 - 2*fuzzyPenalty, ok: true},
+		{query: "host:cxstxmer", fuzzy: true, score: ScoreHost/2 - 2*fuzzyPenalty, ok: true},
+		{query: "cxstxmxr", fuzzy: true, ok: false},
+		{query: "adn", fuzzy: true, ok: false},
+		{query: "/cust.mer/", fuzzy: true, score: ScoreName, ok: true},
+		{query: "/custmer/", fuzzy: true, ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			q.Fuzzy = tt.fuzzy
+			score, ok := q.Rank(s)
+			if ok != tt.ok {
+				t.Fatalf("got match %t, want %t", ok, tt.ok)
+			}
+			if ok && score != tt.score {
+				t.Errorf("got score %d, want %d", score, tt.score)
+			}
+		})
+	}
+}
+
+func TestRankSessions(t *testing.T) {
+	sessions := []*CumulocitySession{
+		{Name: "example.com staging", Host: "https://staging.example.org"},
+		{Name: "first", Host: "https://a.example.com"},
+		{Name: "exact", Host: "https://example.com"},
+		{Name: "second", Host: "https://b.example.com"},
+		{Name: "other", Host: "https://other.org"},
+	}
+	tests := []struct {
+		query string
+		want  string
+	}{
+		// The exact host match beats the name match, and sessions with the same score keep their order
+		{query: "example.com", want: "exact,example.com staging,first,second"},
+		{query: "host:example.com", want: "exact,first,second"},
+		{query: "example", want: "exact,example.com staging,first,second"},
+		{query: "-example", want: "other"},
+		{query: "", want: "example.com staging,first,exact,second,other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			names := make([]string, 0)
+			for _, r := range RankSessions(q, sessions) {
+				names = append(names, r.Session.Name)
+			}
+			if got := strings.Join(names, ","); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBestMatch(t *testing.T) {
+	sessions := []*CumulocitySession{
+		{Name: "customer a prod", Host: "https://customer-a.example.com", Tenant: "t100"},
+		{Name: "customer a dev", Host: "https://customer-a-dev.example.com", Tenant: "t101"},
+		{Name: "customer b", Host: "https://customer-b.example.com", Tenant: "t200"},
+		{Name: "edge tenant", Host: "https://x.example.org", Tenant: "edge"},
+		{Name: "edge host", Host: "https://edge.example.org", Tenant: "t300"},
+	}
+	tests := []struct {
+		query string
+		want  string
+		ok    bool
+	}{
+		// Only one match
+		{query: "customer-b", want: "customer b", ok: true},
+		// An exact tenant is clearly better than a partial tenant match
+		{query: "t100", want: "customer a prod", ok: true},
+		// An exact host is clearly better than a host prefix
+		{query: "customer-a.example.com", want: "customer a prod", ok: true},
+		// Both sessions match the name equally well
+		{query: `"customer a"`, ok: false},
+		// Both hosts start with the term
+		{query: "host:customer-a", ok: false},
+		// The exact tenant scores higher than the host prefix, but the lead is below the margin
+		{query: "edge", ok: false},
+		{query: "tenant:edge", want: "edge tenant", ok: true},
+		{query: "customer", ok: false},
+		{query: "missing", ok: false},
+		// Negated terms don't count, so there is nothing to compare
+		{query: "-customer-b", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			best, ok := BestMatch(q, sessions)
+			if ok != tt.ok {
+				t.Fatalf("got ok %t, want %t", ok, tt.ok)
+			}
+			if ok && best.Name != tt.want {
+				t.Errorf("got %q, want %q", best.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "", b: "", want: 0},
+		{a: "", b: "abc", want: 3},
+		{a: "abc", b: "", want: 3},
+		{a: "abc", b: "abc", want: 0},
+		{a: "abc", b: "abd", want: 1},
+		{a: "abc", b: "abcd", want: 1},
+		{a: "abcd", b: "acd", want: 1},
+		{a: "ab", b: "ba", want: 1},
+		{a: "tenant", b: "tenatn", want: 1},
+		{a: "abcd", b: "badc", want: 2},
+		{a: "kitten", b: "sitting", want: 3},
+		{a: "über", b: "uber", want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+"/"+tt.b, func(t *testing.T) {
+			if got := editDistance(tt.a, tt.b); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+			if got := editDistance(tt.b, tt.a); got != tt.want {
+				t.Errorf("got %d for the reversed strings, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxTypos(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+	}{
+		{value: "", want: 0},
+		{value: "abc", want: 0},
+		{value: "abcd", want: 1},
+		{value: "abcdefg", want: 1},
+		{value: "abcdefgh", want: 2},
+		{value: "äöüß", want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := maxTypos(tt.value); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -22,6 +22,26 @@ func MarshalSessionType(v string) (string, error) {
 	}
 }
 
+var LoginTypeBasic = "BASIC"
+var LoginTypeOAuth2Internal = "OAUTH2_INTERNAL"
+var LoginTypeCertificate = "CERTIFICATE"
+
+// LoginTypes lists the login types supported by go-c8y-cli
+var LoginTypes = []string{LoginTypeBasic, LoginTypeOAuth2Internal, LoginTypeCertificate}
+
+func MarshalLoginType(v string) (string, error) {
+	switch strings.ToUpper(strings.TrimSpace(v)) {
+	case "BASIC":
+		return LoginTypeBasic, nil
+	case "OAUTH2_INTERNAL", "OAUTH2":
+		return LoginTypeOAuth2Internal, nil
+	case "CERTIFICATE", "CERT":
+		return LoginTypeCertificate, nil
+	default:
+		return "", fmt.Errorf("unknown login type: %s", v)
+	}
+}
+
 type CumulocitySession struct {
 	SessionURI string `json:"sessionUri,omitempty"`
 	Name       string `json:"name,omitempty"`
@@ -34,9 +54,25 @@ type CumulocitySession struct {
 	Mode       string `json:"mode,omitempty"`
 	LoginType  string `json:"loginType,omitempty"`
 
+	// Notes are free text notes stored alongside the session
+	Notes string `json:"notes,omitempty"`
+
+	// RevisionDate is the date (RFC3339) when the session was last modified
+	RevisionDate string `json:"revisionDate,omitempty"`
+
+	// URIs are all of the URIs of the session. The Host is the first one
+	URIs []string `json:"-"`
+
+	// Fields are the values of the editable custom fields (see EditableFields) as they are stored,
+	// as the Mode and LoginType are normalised
+	Fields map[string]string `json:"-"`
+
 	// Bitwarden specific
 	FolderID   string `json:"folderId,omitempty"`
 	FolderName string `json:"folderName,omitempty"`
+
+	OrganizationID   string `json:"organizationId,omitempty"`
+	OrganizationName string `json:"organizationName,omitempty"`
 }
 
 // CloneSession only returns the subset of session details which are to be passed back to the caller
@@ -51,30 +87,25 @@ func CloneSession(s *CumulocitySession) *CumulocitySession {
 		FolderName: s.FolderName,
 		Mode:       s.Mode,
 		LoginType:  s.LoginType,
+
+		OrganizationID:   s.OrganizationID,
+		OrganizationName: s.OrganizationName,
 	}
 }
 
-// MatchSession checks if the session matches a list of search terms
+// MatchSession checks if the session matches a list of search terms. The terms are parsed
+// using the query language (see Query). If the terms are not a valid query, then each term must
+// be contained (case-insensitive) in the session
 func MatchSession(s *CumulocitySession, searchTerms ...string) bool {
-	matches := 0
+	if q, err := ParseQueryTerms(searchTerms...); err == nil {
+		return q.Match(s)
+	}
 	for _, term := range searchTerms {
-		if strings.Contains(s.Username, term) {
-			matches++
-		} else if strings.Contains(s.Host, term) {
-			matches++
-		} else if strings.Contains(s.Name, term) {
-			matches++
-		} else if strings.Contains(s.Description(), term) {
-			matches++
-		} else if strings.Contains(s.SessionURI, term) {
-			matches++
-		} else if strings.Contains(s.Tenant, term) {
-			matches++
-		} else if strings.Contains(s.Mode, term) {
-			matches++
+		if !(termNode{value: strings.ToLower(term)}).match(s) {
+			return false
 		}
 	}
-	return len(searchTerms) == matches
+	return true
 }
 
 func (i CumulocitySession) FilterValue() string {
@@ -0,0 +1,174 @@
+package state
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/reubenmiller/c8y-session-bitwarden/pkg/core"
+)
+
+const (
+	SortVault     = "vault"
+	SortRecent    = "mru"
+	SortFrequency = "frequency"
+
+	// HistoryExpiry is the duration after which unused history entries are removed
+	HistoryExpiry = 90 * 24 * time.Hour
+
+	historyFile = "history.json"
+)
+
+// SortOptions lists the supported session orderings
+var SortOptions = []string{SortVault, SortRecent, SortFrequency}
+
+func init() {
+	forgetters = append(forgetters, func(sessionURIs ...string) error {
+		h, err := LoadHistory()
+		if err != nil {
+			return err
+		}
+		if h.Remove(sessionURIs...) {
+			return h.Save()
+		}
+		return nil
+	})
+}
+
+// HistoryEntry records when a session was selected. No secrets are stored
+type HistoryEntry struct {
+	SessionURI string    `json:"sessionUri"`
+	FolderID   string    `json:"folderId,omitempty"`
+	LastUsed   time.Time `json:"lastUsed"`
+	Count      int       `json:"count"`
+}
+
+// History of the selected sessions
+type History struct {
+	Entries []HistoryEntry `json:"entries"`
+
+	path string
+}
+
+// LoadHistory reads the history from the state directory. Expired entries are removed
+func LoadHistory() (*History, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	h := &History{
+		Entries: make([]HistoryEntry, 0),
+		path:    filepath.Join(dir, historyFile),
+	}
+
+	contents, err := os.ReadFile(h.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return h, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(contents, h); err != nil {
+		return nil, fmt.Errorf("invalid history file. path=%s, err=%w", h.path, err)
+	}
+
+	h.Entries = slices.DeleteFunc(h.Entries, func(e HistoryEntry) bool {
+		return time.Since(e.LastUsed) > HistoryExpiry
+	})
+	return h, nil
+}
+
+// Save writes the history to the state directory
+func (h *History) Save() error {
+	if err := os.MkdirAll(filepath.Dir(h.path), 0o700); err != nil {
+		return err
+	}
+	contents, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(h.path, contents, 0o600)
+}
+
+// Record adds a selection of the session to the history
+func (h *History) Record(s *core.CumulocitySession) {
+	idx := slices.IndexFunc(h.Entries, func(e HistoryEntry) bool {
+		return e.SessionURI == s.SessionURI
+	})
+	if idx == -1 {
+		h.Entries = append(h.Entries, HistoryEntry{SessionURI: s.SessionURI})
+		idx = len(h.Entries) - 1
+	}
+	h.Entries[idx].FolderID = s.FolderID
+	h.Entries[idx].LastUsed = time.Now()
+	h.Entries[idx].Count++
+}
+
+// Remove removes the sessions from the history. It returns true if any entries were removed
+func (h *History) Remove(sessionURIs ...string) bool {
+	n := len(h.Entries)
+	h.Entries = slices.DeleteFunc(h.Entries, func(e HistoryEntry) bool {
+		return slices.Contains(sessionURIs, e.SessionURI)
+	})
+	return len(h.Entries) != n
+}
+
+// Last returns the SessionURI of the most recently selected session
+func (h *History) Last() (string, bool) {
+	if len(h.Entries) == 0 {
+		return "", false
+	}
+	last := slices.MaxFunc(h.Entries, func(a, b HistoryEntry) int {
+		return a.LastUsed.Compare(b.LastUsed)
+	})
+	return last.SessionURI, true
+}
+
+// Prune removes the entries of sessions which no longer exist. Since the sessions are normally
+// filtered (e.g. by folder), only entries belonging to the same folders as the given sessions are considered.
+// It returns true if any entries were removed
+func (h *History) Prune(sessions []*core.CumulocitySession) bool {
+	folders := make(map[string]bool)
+	existing := make(map[string]bool)
+	for _, s := range sessions {
+		folders[s.FolderID] = true
+		existing[s.SessionURI] = true
+	}
+	n := len(h.Entries)
+	h.Entries = slices.DeleteFunc(h.Entries, func(e HistoryEntry) bool {
+		return folders[e.FolderID] && !existing[e.SessionURI]
+	})
+	return len(h.Entries) != n
+}
+
+// Sort orders the sessions (in place) by the given ordering. Sessions without any history
+// keep their original (vault) order after the sessions with history
+func (h *History) Sort(sessions []*core.CumulocitySession, order string) error {
+	order = strings.ToLower(order)
+	switch order {
+	case "", SortVault:
+		return nil
+	case SortRecent, SortFrequency:
+	default:
+		return fmt.Errorf("invalid sort order: %s. allowed values: %s", order, strings.Join(SortOptions, ", "))
+	}
+
+	entries := make(map[string]HistoryEntry, len(h.Entries))
+	for _, e := range h.Entries {
+		entries[e.SessionURI] = e
+	}
+	slices.SortStableFunc(sessions, func(a, b *core.CumulocitySession) int {
+		ea, eb := entries[a.SessionURI], entries[b.SessionURI]
+		if order == SortFrequency && ea.Count != eb.Count {
+			return cmp.Compare(eb.Count, ea.Count)
+		}
+		return eb.LastUsed.Compare(ea.LastUsed)
+	})
+	return nil
+}
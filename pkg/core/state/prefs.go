@@ -0,0 +1,147 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/reubenmiller/c8y-session-bitwarden/pkg/core"
+)
+
+const prefsFile = "prefs.json"
+
+// Prefs are the hidden and pinned sessions by SessionURI. No secrets are stored.
+// It is safe for concurrent use, as the picker reads the preferences in the background
+type Prefs struct {
+	Hidden []string `json:"hidden"`
+	Pinned []string `json:"pinned"`
+
+	mu   sync.RWMutex
+	path string
+}
+
+// LoadPrefs reads the preferences from the state directory
+func LoadPrefs() (*Prefs, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	p := &Prefs{
+		Hidden: make([]string, 0),
+		Pinned: make([]string, 0),
+		path:   filepath.Join(dir, prefsFile),
+	}
+
+	contents, err := os.ReadFile(p.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return p, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(contents, p); err != nil {
+		return nil, fmt.Errorf("invalid preferences file. path=%s, err=%w", p.path, err)
+	}
+	return p, nil
+}
+
+// Save writes the preferences to the state directory
+func (p *Prefs) Save() error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if err := os.MkdirAll(filepath.Dir(p.path), 0o700); err != nil {
+		return err
+	}
+	contents, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p.path, contents, 0o600)
+}
+
+// IsHidden returns true if the session should not be listed by default
+func (p *Prefs) IsHidden(sessionURI string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return slices.Contains(p.Hidden, sessionURI)
+}
+
+// IsPinned returns true if the session should be listed first
+func (p *Prefs) IsPinned(sessionURI string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return slices.Contains(p.Pinned, sessionURI)
+}
+
+// SetHidden hides or unhides a session, and saves the preferences
+func (p *Prefs) SetHidden(sessionURI string, hidden bool) error {
+	p.mu.Lock()
+	p.Hidden = setValue(p.Hidden, sessionURI, hidden)
+	p.mu.Unlock()
+	return p.Save()
+}
+
+// SetPinned pins or unpins a session, and saves the preferences
+func (p *Prefs) SetPinned(sessionURI string, pinned bool) error {
+	p.mu.Lock()
+	p.Pinned = setValue(p.Pinned, sessionURI, pinned)
+	p.mu.Unlock()
+	return p.Save()
+}
+
+func setValue(values []string, v string, enabled bool) []string {
+	values = slices.DeleteFunc(values, func(s string) bool {
+		return s == v
+	})
+	if enabled {
+		values = append(values, v)
+	}
+	return values
+}
+
+// Remove removes the preferences of the sessions. It returns true if any preferences were removed
+func (p *Prefs) Remove(sessionURIs ...string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := len(p.Hidden) + len(p.Pinned)
+	match := func(s string) bool {
+		return slices.Contains(sessionURIs, s)
+	}
+	p.Hidden = slices.DeleteFunc(p.Hidden, match)
+	p.Pinned = slices.DeleteFunc(p.Pinned, match)
+	return len(p.Hidden)+len(p.Pinned) != n
+}
+
+// Filter returns the sessions which are not hidden
+func (p *Prefs) Filter(sessions []*core.CumulocitySession) []*core.CumulocitySession {
+	return slices.DeleteFunc(slices.Clone(sessions), func(s *core.CumulocitySession) bool {
+		return p.IsHidden(s.SessionURI)
+	})
+}
+
+// Sort moves the pinned sessions (in place) to the top whilst keeping the order of the other sessions
+func (p *Prefs) Sort(sessions []*core.CumulocitySession) {
+	slices.SortStableFunc(sessions, func(a, b *core.CumulocitySession) int {
+		pa, pb := p.IsPinned(a.SessionURI), p.IsPinned(b.SessionURI)
+		switch {
+		case pa == pb:
+			return 0
+		case pa:
+			return -1
+		default:
+			return 1
+		}
+	})
+}
+
+// Reset removes all of the preferences
+func (p *Prefs) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Hidden = make([]string, 0)
+	p.Pinned = make([]string, 0)
+}
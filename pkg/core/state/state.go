@@ -0,0 +1,50 @@
+package state
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// EnvStateDir can be used to override the directory where the local state is stored
+const EnvStateDir = "C8Y_SESSION_BITWARDEN_STATE_DIR"
+
+// forgetters remove any state related to the given sessions from the shared state files
+var forgetters []func(sessionURIs ...string) error
+
+// Dir returns the directory where the local state (caches, history etc.) is stored.
+// Secrets must never be written to this directory
+func Dir() (string, error) {
+	if v := os.Getenv(EnvStateDir); v != "" {
+		return v, nil
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "c8y-session-bitwarden"), nil
+}
+
+// Clear removes the local state of the given sessions. If no sessions are given,
+// then the local state of all sessions is removed. Only the files created by this tool are removed,
+// as the state directory can be set to a directory which is shared with other files.
+// The hidden and pinned sessions are kept, as they are chosen by the user (see Prefs.Reset)
+func Clear(sessionURIs ...string) error {
+	if len(sessionURIs) == 0 {
+		dir, err := Dir()
+		if err != nil {
+			return err
+		}
+		errs := make([]error, 0)
+		for _, name := range []string{historyFile} {
+			errs = append(errs, os.RemoveAll(filepath.Join(dir, name)))
+		}
+		return errors.Join(errs...)
+	}
+
+	errs := make([]error, 0)
+	for _, forget := range forgetters {
+		errs = append(errs, forget(sessionURIs...))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,25 @@
+package core
+
+import (
+	"time"
+
+	"github.com/pquerna/otp/totp"
+)
+
+func GetTOTPCode(secret string, t time.Time) (string, error) {
+	if t.Year() == 0 {
+		t = time.Now()
+	}
+	return totp.GenerateCode(secret, t)
+}
+
+func GetTOTPCodeFromSecret(secret string) (string, error) {
+	now := time.Now()
+	totpTime := now
+	totpPeriod := 30
+	totpNextTransition := totpPeriod - now.Second()%30
+	if totpNextTransition < 5 {
+		totpTime = now.Add(30 * time.Second)
+	}
+	return GetTOTPCode(secret, totpTime)
+}